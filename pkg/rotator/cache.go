@@ -0,0 +1,238 @@
+package rotator
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"strings"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+// watchCache is a reader of the secrets and webhooks that also returns the cache each of them
+// is watched through.
+type watchCache interface {
+	SyncingReader
+	// forObject returns the cache the object of the given kind and key is watched through.
+	forObject(obj client.Object, key types.NamespacedName) (cache.Cache, error)
+}
+
+// sharedCache watches every object through a single cache, e.g. the cache of the manager
+// set as CertRotator.Reader.
+type sharedCache struct {
+	cache.Cache
+}
+
+func (c sharedCache) forObject(client.Object, types.NamespacedName) (cache.Cache, error) {
+	return c.Cache, nil
+}
+
+// objectKey is the kind and key of an object managed by the rotator.
+type objectKey struct {
+	gvk schema.GroupVersionKind
+	key types.NamespacedName
+}
+
+// objectCaches watches every object managed by the rotator through its own cache, restricted
+// to it with a `metadata.name` field selector, so that the rotator neither caches other objects
+// of their kinds nor needs permission to list and watch them. A field selector selects a single
+// name, hence the cache per object. The caches of webhooks whose kind is not served yet are
+// added once it is.
+type objectCaches struct {
+	mgr    manager.Manager
+	config *rest.Config
+	scheme *runtime.Scheme
+	mapper meta.RESTMapper
+	// leaderElection is true if the caches of the webhooks are only started by the leader,
+	// while every replica watches the secrets.
+	leaderElection bool
+	// leading returns true if the replica is the leader, see CertRotator.leading.
+	leading func() bool
+
+	mu     sync.Mutex
+	caches map[objectKey]cache.Cache
+}
+
+var _ watchCache = &objectCaches{}
+
+// addObjectCaches adds the caches of the objects of the named cluster, or of the cluster of
+// the manager if the name is empty, to the manager. The caches are started by the manager
+// when it starts, and consumers should synchronize on them using WaitForCacheSync().
+func addObjectCaches(mgr manager.Manager, cr *CertRotator, cluster string, config *rest.Config, mapper meta.RESTMapper) (*objectCaches, error) {
+	c := &objectCaches{
+		mgr:    mgr,
+		config: config,
+		scheme: mgr.GetScheme(),
+		mapper: mapper,
+		// The webhooks are only injected by the leader when CertRotator.RequireLeaderElection
+		// is true, in every cluster, while every replica watches the secrets.
+		leaderElection: cr.RequireLeaderElection,
+		leading:        cr.leading,
+		caches:         make(map[objectKey]cache.Cache),
+	}
+	objs, err := cachedObjects(cr, cluster, cr.SecretKey.Namespace, mapper)
+	if err != nil {
+		return nil, err
+	}
+	for _, obj := range objs {
+		if _, err := c.forObject(obj.obj, obj.key); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// cachedObject is an object cached by the rotator.
+type cachedObject struct {
+	obj client.Object
+	key types.NamespacedName
+}
+
+// cachedObjects returns the objects of the named cluster cached by the rotator: the webhooks
+// of the cluster whose kind is served, and the secrets for the cluster of the manager, whose
+// name is empty.
+func cachedObjects(cr *CertRotator, cluster, namespace string, mapper meta.RESTMapper) ([]cachedObject, error) {
+	var objs []cachedObject
+	if cluster == "" {
+		objs = append(objs, cachedObject{obj: &corev1.Secret{}, key: cr.SecretKey})
+		for _, key := range cr.otherSecretKeys() {
+			objs = append(objs, cachedObject{obj: &corev1.Secret{}, key: key})
+		}
+	}
+	for _, webhook := range cr.Webhooks {
+		if webhook.Cluster != cluster {
+			continue
+		}
+		target, err := webhook.target()
+		if err != nil {
+			return nil, err
+		}
+		gvk, err := target.resolveGVK(mapper)
+		if meta.IsNoMatchError(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		u := &unstructured.Unstructured{}
+		u.SetGroupVersionKind(gvk)
+		objs = append(objs, cachedObject{obj: u, key: webhook.key(namespace)})
+	}
+	return objs, nil
+}
+
+// objectCacheOptions returns the options of the cache of a single object, whose informer
+// only lists and watches the object by name.
+func objectCacheOptions(scheme *runtime.Scheme, mapper meta.RESTMapper, obj client.Object, key types.NamespacedName) cache.Options {
+	selector := fields.OneTermEqualSelector("metadata.name", key.Name)
+	byObject := cache.ByObject{Field: selector}
+	if key.Namespace != "" {
+		byObject = cache.ByObject{Namespaces: map[string]cache.Config{key.Namespace: {FieldSelector: selector}}}
+	}
+	return cache.Options{
+		Scheme:   scheme,
+		Mapper:   mapper,
+		ByObject: map[client.Object]cache.ByObject{obj: byObject},
+	}
+}
+
+// forObject returns the cache of the object, and adds it to the manager if it does not exist yet.
+func (c *objectCaches) forObject(obj client.Object, key types.NamespacedName) (cache.Cache, error) {
+	gvk, err := apiutil.GVKForObject(obj, c.scheme)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	k := objectKey{gvk: gvk, key: key}
+	if objCache, ok := c.caches[k]; ok {
+		return objCache, nil
+	}
+	objCache, err := cache.New(c.config, objectCacheOptions(c.scheme, c.mapper, obj.DeepCopyObject().(client.Object), key))
+	if err != nil {
+		return nil, fmt.Errorf("creating cache of %s %s: %w", gvk.Kind, key, err)
+	}
+	// Wrapping the cache to make sure the caches of the secrets are also started when the
+	// manager hasn't been leader elected, as every replica watches the secret.
+	if err := c.mgr.Add(&cacheWrapper{Cache: objCache, needLeaderElection: c.needLeaderElection(k)}); err != nil {
+		return nil, fmt.Errorf("registering cache of %s %s: %w", gvk.Kind, key, err)
+	}
+	c.caches[k] = objCache
+	return objCache, nil
+}
+
+// needLeaderElection returns true if the cache of the object is only started by the leader.
+func (c *objectCaches) needLeaderElection(k objectKey) bool {
+	return c.leaderElection && k.gvk != corev1.SchemeGroupVersion.WithKind("Secret")
+}
+
+// Get reads the object from its cache, waiting for the cache to sync if it was just added.
+func (c *objectCaches) Get(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+	objCache, err := c.forObject(obj, key)
+	if err != nil {
+		return err
+	}
+	if !objCache.WaitForCacheSync(ctx) {
+		return fmt.Errorf("waiting for the cache of %s to sync", key)
+	}
+	return objCache.Get(ctx, key, obj, opts...)
+}
+
+// List lists the objects of the kind of the list from their caches.
+func (c *objectCaches) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	gvk, err := apiutil.GVKForObject(list, c.scheme)
+	if err != nil {
+		return err
+	}
+	gvk.Kind = strings.TrimSuffix(gvk.Kind, "List")
+	listOpts := (&client.ListOptions{}).ApplyOptions(opts)
+	var items []runtime.Object
+	for k, objCache := range c.snapshot() {
+		if k.gvk != gvk || (listOpts.Namespace != "" && k.key.Namespace != listOpts.Namespace) {
+			continue
+		}
+		objList := list.DeepCopyObject().(client.ObjectList)
+		if err := objCache.List(ctx, objList, opts...); err != nil {
+			return err
+		}
+		objs, err := meta.ExtractList(objList)
+		if err != nil {
+			return err
+		}
+		items = append(items, objs...)
+	}
+	return meta.SetList(list, items)
+}
+
+// WaitForCacheSync waits for the caches added so far to sync, except for the caches only
+// started by the leader on replicas that are not the leader.
+func (c *objectCaches) WaitForCacheSync(ctx context.Context) bool {
+	for k, objCache := range c.snapshot() {
+		if c.needLeaderElection(k) && !c.leading() {
+			continue
+		}
+		if !objCache.WaitForCacheSync(ctx) {
+			return false
+		}
+	}
+	return true
+}
+
+// snapshot returns the caches added so far.
+func (c *objectCaches) snapshot() map[objectKey]cache.Cache {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return maps.Clone(c.caches)
+}
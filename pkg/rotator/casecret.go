@@ -0,0 +1,77 @@
+package rotator
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// separateCASecret returns true if the CA is stored in its own secret.
+func (cr *CertRotator) separateCASecret() bool {
+	return cr.CASecretKey != (types.NamespacedName{})
+}
+
+// caSecretKey returns the secret holding the CA key.
+func (cr *CertRotator) caSecretKey() types.NamespacedName {
+	if cr.separateCASecret() {
+		return cr.CASecretKey
+	}
+	return cr.SecretKey
+}
+
+// writeCASecret writes the CA cert and key to the CA secret.
+func (cr *CertRotator) writeCASecret(caArtifacts *KeyPairArtifacts, caSecret *corev1.Secret) error {
+	if caSecret.Data == nil {
+		caSecret.Data = make(map[string][]byte)
+	}
+	caSecret.Data[caCertName] = caArtifacts.CertPEM
+	if err := cr.protectCAKey(caArtifacts, caSecret); err != nil {
+		return err
+	}
+	return cr.writer.Update(context.Background(), caSecret)
+}
+
+// adoptCA moves a valid CA still held by the secret, e.g. when CASecretKey was set after the
+// CA was issued, to the CA secret if it does not hold a CA yet, so that the CA is not rotated.
+// The CA key is then removed from the secret by removeCAKey.
+func (cr *CertRotator) adoptCA(caSecret, secret *corev1.Secret) (bool, error) {
+	if caSecret.Data[caKeyName] != nil || secret.Data[caKeyName] == nil {
+		return false, nil
+	}
+	caKey, err := cr.caKeyPEM(secret)
+	if err != nil {
+		return false, err
+	}
+	if !cr.validCACert(secret.Data[caCertName], caKey) {
+		return false, nil
+	}
+	caArtifacts, err := cr.caArtifacts(secret)
+	if err != nil {
+		return false, err
+	}
+	if err := cr.writeCASecret(caArtifacts, caSecret); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// removeCAKey removes the CA key from the secret, which the CA secret holds.
+func (cr *CertRotator) removeCAKey(secret *corev1.Secret) error {
+	delete(secret.Data, caKeyName)
+	return cr.writer.Update(context.Background(), secret)
+}
+
+// caCertFromSecret returns the PEM encoded CA cert of the secret.
+func caCertFromSecret(secret *corev1.Secret) ([]byte, error) {
+	caPem, ok := secret.Data[caCertName]
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("Cert secret is not well-formed, missing %s", caCertName))
+	}
+	if _, err := parseCertPEM(caPem); err != nil {
+		return nil, errors.Wrap(err, "while parsing CA cert")
+	}
+	return caPem, nil
+}
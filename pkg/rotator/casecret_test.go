@@ -0,0 +1,86 @@
+package rotator
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestSeparateCASecret(t *testing.T) {
+	ctx := context.Background()
+	caKey := types.NamespacedName{Namespace: "ca", Name: "ca"}
+	rotator, c := newTestRotator(t, &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: caKey.Namespace, Name: caKey.Name}})
+	refresh := func(wantRotatedCA bool) (*corev1.Secret, *corev1.Secret) {
+		secrets, rotatedCA := refreshSecrets(t, rotator, caKey)
+		if rotatedCA != wantRotatedCA {
+			t.Errorf("got rotated CA %t, want %t", rotatedCA, wantRotatedCA)
+		}
+		return secrets[0], secrets[1]
+	}
+
+	// A CA issued before the CA secret is configured is moved to it.
+	secret, _ := refresh(true)
+	ca, serverCert := secret.Data[caCertName], secret.Data[rotator.CertName]
+	rotator.CASecretKey = caKey
+	secret, caSecret := refresh(false)
+	if !bytes.Equal(caSecret.Data[caCertName], ca) || caSecret.Data[caKeyName] == nil {
+		t.Fatal("expected the CA to be moved to the CA secret")
+	}
+	if _, ok := secret.Data[caKeyName]; ok {
+		t.Error("expected the secret not to hold the CA key")
+	}
+	if !bytes.Equal(secret.Data[caCertName], ca) {
+		t.Error("expected the secret to hold the CA cert")
+	}
+	if !bytes.Equal(secret.Data[rotator.CertName], serverCert) {
+		t.Error("expected the server cert not to be re-issued")
+	}
+
+	// The CA is rotated in the CA secret, and the server cert is re-issued by it.
+	delete(caSecret.Data, caKeyName)
+	if err := c.Update(ctx, caSecret); err != nil {
+		t.Fatal(err)
+	}
+	secret, caSecret = refresh(true)
+	if bytes.Equal(caSecret.Data[caCertName], ca) {
+		t.Fatal("expected the CA to be rotated")
+	}
+	if !bytes.Equal(secret.Data[caCertName], caSecret.Data[caCertName]) || secret.Data[caKeyName] != nil {
+		t.Error("expected the secret to hold the rotated CA cert only")
+	}
+	if !rotator.validServerCert(caSecret.Data[caCertName], secret.Data[rotator.CertName], secret.Data[rotator.KeyName]) {
+		t.Error("expected the server cert to be re-issued by the rotated CA")
+	}
+
+	// The secret is updated when it does not hold the CA cert of the CA secret.
+	secret.Data[caCertName] = ca
+	if err := c.Update(ctx, secret); err != nil {
+		t.Fatal(err)
+	}
+	secret, caSecret = refresh(true)
+	if !bytes.Equal(secret.Data[caCertName], caSecret.Data[caCertName]) {
+		t.Error("expected the secret to hold the CA cert of the CA secret")
+	}
+	refresh(false)
+
+	// A CA key leaked to the secret is removed without re-issuing the server cert.
+	serverCert = secret.Data[rotator.CertName]
+	secret.Data[caKeyName] = caSecret.Data[caKeyName]
+	if err := c.Update(ctx, secret); err != nil {
+		t.Fatal(err)
+	}
+	secret, caSecret = refresh(false)
+	if _, ok := secret.Data[caKeyName]; ok {
+		t.Error("expected the CA key to be removed from the secret")
+	}
+	if caSecret.Data[caKeyName] == nil {
+		t.Error("expected the CA secret to hold the CA key")
+	}
+	if !bytes.Equal(secret.Data[rotator.CertName], serverCert) {
+		t.Error("expected the server cert not to be re-issued")
+	}
+}
@@ -0,0 +1,53 @@
+package rotator
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// ClientCert is a client certificate for mutual TLS issued by the CA of the CertRotator,
+// e.g. for a webhook to authenticate to an external data provider.
+type ClientCert struct {
+	// SecretKey is the secret the client cert is stored in, under CertName and KeyName along
+	// with the CA cert under ca.crt. Like the secret of the CertRotator, it must exist.
+	SecretKey types.NamespacedName
+	// Subject is the subject of the client cert, e.g. the user name as CommonName and
+	// the groups as Organization for Kubernetes RBAC.
+	Subject pkix.Name
+	// Duration sets how long the client cert will be valid for. Defaults to ServerCertDuration.
+	Duration time.Duration
+}
+
+// clientCertSpec returns the desired spec of the client cert.
+func (cr *CertRotator) clientCertSpec(clientCert ClientCert) certSpec {
+	duration := clientCert.Duration
+	if duration == 0 {
+		duration = cr.ServerCertDuration
+	}
+	spec := certSpec{
+		subject:      clientCert.Subject,
+		keyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		extKeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		keyAlgorithm: x509.RSA,
+		keySize:      rsaKeySize,
+	}
+	if duration != 0 {
+		spec.validity = duration + certBackdate
+	}
+	return spec
+}
+
+// CreateClientCertPEM takes the results of CreateCACert and uses it to create the
+// PEM-encoded public certificate and private key of the client cert, respectively.
+func (cr *CertRotator) CreateClientCertPEM(ca *KeyPairArtifacts, clientCert ClientCert, begin, end time.Time) ([]byte, []byte, error) {
+	return createCertPEM(ca, cr.clientCertSpec(clientCert), begin, end)
+}
+
+// validClientCert returns true if the client cert is valid for client authentication
+// with the CA cert and matches its desired spec.
+func (cr *CertRotator) validClientCert(clientCert ClientCert, caCert, cert, key []byte) bool {
+	return cr.validLeafCert(cr.clientLeafCert(clientCert), caCert, cert, key)
+}
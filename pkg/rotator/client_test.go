@@ -0,0 +1,59 @@
+package rotator
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509/pkix"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestRefreshClientCerts(t *testing.T) {
+	ctx := context.Background()
+	clientKey := types.NamespacedName{Namespace: "other", Name: "client"}
+	rotator, c := newTestRotator(t, &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: clientKey.Namespace, Name: clientKey.Name}})
+	rotator.ClientCerts = []ClientCert{{
+		SecretKey: clientKey,
+		Subject:   pkix.Name{CommonName: "gatekeeper", Organization: []string{"system:authenticated"}},
+	}}
+
+	secrets, _ := refreshSecrets(t, rotator, clientKey)
+	secret, clientSecret := secrets[0], secrets[1]
+	if !bytes.Equal(clientSecret.Data[caCertName], secret.Data[caCertName]) {
+		t.Error("expected the client secret to hold the CA cert")
+	}
+	if _, ok := clientSecret.Data[caKeyName]; ok {
+		t.Error("expected the client secret not to hold the CA key")
+	}
+	clientCert := clientSecret.Data[rotator.CertName]
+	if !rotator.validClientCert(rotator.ClientCerts[0], secret.Data[caCertName], clientCert, clientSecret.Data[rotator.KeyName]) {
+		t.Fatal("expected the client cert to be valid")
+	}
+	crt, err := parseCertPEM(clientCert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := crt.Subject.String(); got != "CN=gatekeeper,O=system:authenticated" {
+		t.Errorf("got subject %s", got)
+	}
+
+	// The client cert is kept while it is valid.
+	secrets, _ = refreshSecrets(t, rotator, clientKey)
+	if secrets[1].ResourceVersion != clientSecret.ResourceVersion {
+		t.Error("expected the client secret not to be updated")
+	}
+
+	// The client cert is re-issued when the CA is rotated.
+	delete(secret.Data, caCertName)
+	if err := c.Update(ctx, secret); err != nil {
+		t.Fatal(err)
+	}
+	secrets, _ = refreshSecrets(t, rotator, clientKey)
+	secret, refreshed := secrets[0], secrets[1]
+	if !bytes.Equal(refreshed.Data[caCertName], secret.Data[caCertName]) || bytes.Equal(refreshed.Data[rotator.CertName], clientCert) {
+		t.Error("expected the client cert to be re-issued by the rotated CA")
+	}
+}
@@ -0,0 +1,378 @@
+package rotator
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// CABundleEncoding is the encoding of the CA bundle written to a field.
+type CABundleEncoding int
+
+const (
+	// Base64Encoding writes the PEM encoded CA bundle base64 encoded, as expected by `caBundle` fields.
+	Base64Encoding CABundleEncoding = iota
+	// PEMEncoding writes the PEM encoded CA bundle as-is.
+	PEMEncoding
+)
+
+// injectionTarget describes where the CA bundle is written in a resource of a given kind.
+// Unless the version of gvk is set, the version preferred by the API server is used.
+type injectionTarget struct {
+	gvk schema.GroupVersionKind
+	// resource is the plural resource name of built-in targets.
+	resource   string
+	namespaced bool
+	paths      []fieldPath
+	encoding   CABundleEncoding
+	// createMissing creates missing intermediate fields instead of failing.
+	createMissing bool
+	// servicePaths are the paths to the Service references of built-in targets.
+	servicePaths []fieldPath
+}
+
+var builtinTargets = map[WebhookType]injectionTarget{
+	Validating: {
+		gvk:          schema.GroupVersionKind{Group: "admissionregistration.k8s.io", Kind: "ValidatingWebhookConfiguration"},
+		resource:     "validatingwebhookconfigurations",
+		paths:        []fieldPath{mustParseFieldPath("webhooks[*].clientConfig.caBundle")},
+		servicePaths: []fieldPath{mustParseFieldPath("webhooks[*].clientConfig.service")},
+	},
+	Mutating: {
+		gvk:          schema.GroupVersionKind{Group: "admissionregistration.k8s.io", Kind: "MutatingWebhookConfiguration"},
+		resource:     "mutatingwebhookconfigurations",
+		paths:        []fieldPath{mustParseFieldPath("webhooks[*].clientConfig.caBundle")},
+		servicePaths: []fieldPath{mustParseFieldPath("webhooks[*].clientConfig.service")},
+	},
+	CRDConversion: {
+		gvk:          schema.GroupVersionKind{Group: "apiextensions.k8s.io", Kind: "CustomResourceDefinition"},
+		resource:     "customresourcedefinitions",
+		paths:        []fieldPath{mustParseFieldPath("spec.conversion.webhook.clientConfig.caBundle")},
+		servicePaths: []fieldPath{mustParseFieldPath("spec.conversion.webhook.clientConfig.service")},
+	},
+	APIService: {
+		gvk:          schema.GroupVersionKind{Group: "apiregistration.k8s.io", Kind: "APIService"},
+		resource:     "apiservices",
+		paths:        []fieldPath{mustParseFieldPath("spec.caBundle")},
+		servicePaths: []fieldPath{mustParseFieldPath("spec.service")},
+	},
+	ExternalDataProvider: {
+		gvk:      schema.GroupVersionKind{Group: "externaldata.gatekeeper.sh", Kind: "Provider"},
+		resource: "providers",
+		paths:    []fieldPath{mustParseFieldPath("spec.caBundle")},
+	},
+	ConfigMap: {
+		gvk:           schema.GroupVersionKind{Kind: "ConfigMap"},
+		resource:      "configmaps",
+		namespaced:    true,
+		paths:         []fieldPath{mustParseFieldPath(`data.ca\.crt`)},
+		encoding:      PEMEncoding,
+		createMissing: true,
+	},
+}
+
+// target returns where and how the CA bundle is injected for the webhook.
+func (w WebhookInfo) target() (injectionTarget, error) {
+	if w.Type != Generic {
+		t, ok := builtinTargets[w.Type]
+		if !ok {
+			return injectionTarget{}, fmt.Errorf("incorrect webhook type")
+		}
+		if !t.namespaced && w.Namespace != "" {
+			return injectionTarget{}, fmt.Errorf("webhook %s: %s is cluster-scoped but namespace %s is set", w.Name, t.gvk.Kind, w.Namespace)
+		}
+		if w.Version != "" {
+			t.gvk.Version = w.Version
+		}
+		return t, nil
+	}
+	if w.GVK.Kind == "" {
+		return injectionTarget{}, fmt.Errorf("webhook %s: GVK is required for Generic webhooks", w.Name)
+	}
+	if len(w.FieldPaths) == 0 {
+		return injectionTarget{}, fmt.Errorf("webhook %s: FieldPaths are required for Generic webhooks", w.Name)
+	}
+	if w.Encoding != Base64Encoding && w.Encoding != PEMEncoding {
+		return injectionTarget{}, fmt.Errorf("webhook %s: unknown CA bundle encoding %d", w.Name, w.Encoding)
+	}
+	t := injectionTarget{gvk: w.GVK, encoding: w.Encoding}
+	if w.Version != "" {
+		t.gvk.Version = w.Version
+	}
+	for _, p := range w.FieldPaths {
+		path, err := parseFieldPath(p)
+		if err != nil {
+			return injectionTarget{}, fmt.Errorf("webhook %s: %w", w.Name, err)
+		}
+		t.paths = append(t.paths, path)
+	}
+	return t, nil
+}
+
+// resolveGVK returns the kind of the target in the version served by the API server.
+// A NoMatch error is returned if the kind is not served (yet), e.g. because its CRD is not installed.
+func (t injectionTarget) resolveGVK(mapper meta.RESTMapper) (schema.GroupVersionKind, error) {
+	var versions []string
+	if t.gvk.Version != "" {
+		versions = append(versions, t.gvk.Version)
+	}
+	mapping, err := mapper.RESTMapping(t.gvk.GroupKind(), versions...)
+	if err != nil {
+		kind := t.gvk.GroupKind().String()
+		if t.gvk.Version != "" {
+			kind = t.gvk.String()
+		}
+		if meta.IsNoMatchError(err) {
+			return schema.GroupVersionKind{}, fmt.Errorf("%s is not served by the API server, is its CRD installed?: %w", kind, err)
+		}
+		return schema.GroupVersionKind{}, fmt.Errorf("resolving %s: %w", kind, err)
+	}
+	return mapping.GroupVersionKind, nil
+}
+
+// key returns the key of the resource of the webhook. Namespaced built-in resources
+// without a namespace are looked up in defaultNamespace.
+func (w WebhookInfo) key(defaultNamespace string) types.NamespacedName {
+	key := types.NamespacedName{Namespace: w.Namespace, Name: w.Name}
+	if key.Namespace == "" && builtinTargets[w.Type].namespaced {
+		key.Namespace = defaultNamespace
+	}
+	return key
+}
+
+// pathElement is a single field of a fieldPath. If each is true, the field
+// holds a list and the rest of the path is applied to every item of it.
+type pathElement struct {
+	field string
+	each  bool
+}
+
+// fieldPath is a parsed path to a field in an unstructured object, such as
+// `webhooks[*].clientConfig.caBundle`. Dots inside a field name are escaped
+// with a backslash, e.g. `data.ca\.crt`.
+type fieldPath []pathElement
+
+func (p fieldPath) String() string {
+	fields := make([]string, 0, len(p))
+	for _, e := range p {
+		f := strings.ReplaceAll(e.field, ".", `\.`)
+		if e.each {
+			f += "[*]"
+		}
+		fields = append(fields, f)
+	}
+	return strings.Join(fields, ".")
+}
+
+// hasWildcard returns true if the path matches the items of a list.
+func (p fieldPath) hasWildcard() bool {
+	for _, e := range p {
+		if e.each {
+			return true
+		}
+	}
+	return false
+}
+
+func parseFieldPath(path string) (fieldPath, error) {
+	var (
+		parsed fieldPath
+		field  strings.Builder
+		each   bool
+	)
+	flush := func() error {
+		if field.Len() == 0 {
+			return errors.Errorf("field path %q contains an empty field", path)
+		}
+		parsed = append(parsed, pathElement{field: field.String(), each: each})
+		field.Reset()
+		each = false
+		return nil
+	}
+	for i := 0; i < len(path); i++ {
+		switch {
+		case each && path[i] != '.':
+			return nil, errors.Errorf("field path %q: wildcard must be followed by a field", path)
+		case path[i] == '\\':
+			if i+1 == len(path) {
+				return nil, errors.Errorf("field path %q ends with an escape character", path)
+			}
+			i++
+			field.WriteByte(path[i])
+		case path[i] == '.':
+			if err := flush(); err != nil {
+				return nil, err
+			}
+		case strings.HasPrefix(path[i:], "[*]"):
+			each = true
+			i += len("[*]") - 1
+		default:
+			field.WriteByte(path[i])
+		}
+	}
+	if each {
+		return nil, errors.Errorf("field path %q does not end with a field", path)
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	return parsed, nil
+}
+
+func mustParseFieldPath(path string) fieldPath {
+	p, err := parseFieldPath(path)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+func injectCert(updatedResource *unstructured.Unstructured, certPem []byte, target injectionTarget) error {
+	value := base64.StdEncoding.EncodeToString(certPem)
+	if target.encoding == PEMEncoding {
+		value = string(certPem)
+	}
+	for _, path := range target.paths {
+		if err := setField(updatedResource.Object, path, 0, value, target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// caBundleMatches returns true if every CA bundle field of the resource holds certPem.
+func caBundleMatches(updatedResource *unstructured.Unstructured, certPem []byte, target injectionTarget) bool {
+	for _, path := range target.paths {
+		if !fieldMatches(updatedResource.Object, path, 0, certPem, target) {
+			return false
+		}
+	}
+	return true
+}
+
+// fieldMatches returns true if path[i:] in obj holds certPem in the encoding of the target.
+// Like in setField, lists matched by a wildcard that are missing are skipped.
+func fieldMatches(obj map[string]interface{}, path fieldPath, i int, certPem []byte, target injectionTarget) bool {
+	elem := path[i]
+	if i == len(path)-1 {
+		value, ok := obj[elem.field].(string)
+		if !ok {
+			return false
+		}
+		if target.encoding == PEMEncoding {
+			return value == string(certPem)
+		}
+		decoded, err := base64.StdEncoding.DecodeString(value)
+		return err == nil && bytes.Equal(decoded, certPem)
+	}
+	if elem.each {
+		items, ok := obj[elem.field].([]interface{})
+		if !ok {
+			return obj[elem.field] == nil
+		}
+		for _, item := range items {
+			m, ok := item.(map[string]interface{})
+			if !ok || !fieldMatches(m, path, i+1, certPem, target) {
+				return false
+			}
+		}
+		return true
+	}
+	next, ok := obj[elem.field].(map[string]interface{})
+	return ok && fieldMatches(next, path, i+1, certPem, target)
+}
+
+// services returns the Services referenced by the resource, e.g. by the `clientConfig.service`
+// of its webhooks. References without a namespace are ignored.
+func services(updatedResource *unstructured.Unstructured, target injectionTarget) []types.NamespacedName {
+	var services []types.NamespacedName
+	for _, path := range target.servicePaths {
+		for _, ref := range fieldValues(updatedResource.Object, path, 0) {
+			m, ok := ref.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			name, _, _ := unstructured.NestedString(m, "name")
+			namespace, _, _ := unstructured.NestedString(m, "namespace")
+			if name != "" && namespace != "" {
+				services = append(services, types.NamespacedName{Namespace: namespace, Name: name})
+			}
+		}
+	}
+	return services
+}
+
+// fieldValues returns the values of path[i:] in obj, skipping missing fields.
+func fieldValues(obj map[string]interface{}, path fieldPath, i int) []interface{} {
+	elem := path[i]
+	value, ok := obj[elem.field]
+	if !ok {
+		return nil
+	}
+	if i == len(path)-1 {
+		return []interface{}{value}
+	}
+	if !elem.each {
+		next, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		return fieldValues(next, path, i+1)
+	}
+	items, _ := value.([]interface{})
+	var values []interface{}
+	for _, item := range items {
+		if m, ok := item.(map[string]interface{}); ok {
+			values = append(values, fieldValues(m, path, i+1)...)
+		}
+	}
+	return values
+}
+
+// setField sets path[i:] in obj to value. Lists matched by a wildcard that
+// are missing are skipped, as there is nothing to inject the CA bundle into,
+// while missing fields of their items are created, e.g. the `clientConfig`
+// of a webhook.
+func setField(obj map[string]interface{}, path fieldPath, i int, value string, target injectionTarget) error {
+	elem := path[i]
+	if i == len(path)-1 {
+		obj[elem.field] = value
+		return nil
+	}
+	if elem.each {
+		items, found, err := unstructured.NestedSlice(obj, elem.field)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return nil
+		}
+		for j, item := range items {
+			m, ok := item.(map[string]interface{})
+			if !ok {
+				return errors.Errorf("%s item %d is not well-formed", elem.field, j)
+			}
+			if err := setField(m, path, i+1, value, target); err != nil {
+				return err
+			}
+			items[j] = m
+		}
+		return unstructured.SetNestedSlice(obj, items, elem.field)
+	}
+	next, ok := obj[elem.field].(map[string]interface{})
+	if !ok {
+		if obj[elem.field] != nil || !(target.createMissing || path[:i].hasWildcard()) {
+			return errors.Errorf("`%s` field not found in %s", path[:i+1], target.gvk.Kind)
+		}
+		next = map[string]interface{}{}
+		obj[elem.field] = next
+	}
+	return setField(next, path, i+1, value, target)
+}
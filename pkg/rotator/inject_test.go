@@ -0,0 +1,308 @@
+package rotator
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestParseFieldPath(t *testing.T) {
+	testCases := []struct {
+		path    string
+		want    fieldPath
+		wantErr bool
+	}{
+		{path: "spec.caBundle", want: fieldPath{{field: "spec"}, {field: "caBundle"}}},
+		{path: "webhooks[*].clientConfig.caBundle", want: fieldPath{{field: "webhooks", each: true}, {field: "clientConfig"}, {field: "caBundle"}}},
+		{path: `data.ca\.crt`, want: fieldPath{{field: "data"}, {field: "ca.crt"}}},
+		{path: "", wantErr: true},
+		{path: "spec..caBundle", wantErr: true},
+		{path: "spec.", wantErr: true},
+		{path: "webhooks[*]", wantErr: true},
+		{path: "webhooks[*]clientConfig", wantErr: true},
+		{path: `spec\`, wantErr: true},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.path, func(t *testing.T) {
+			got, err := parseFieldPath(tt.path)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.String() != tt.path {
+				t.Errorf("round trip: got %q, want %q", got.String(), tt.path)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("element %d: got %v, want %v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestInjectCert(t *testing.T) {
+	certPem := []byte("-----BEGIN CERTIFICATE-----\n-----END CERTIFICATE-----\n")
+	encoded := base64.StdEncoding.EncodeToString(certPem)
+
+	testCases := []struct {
+		name    string
+		object  map[string]interface{}
+		target  injectionTarget
+		field   []string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:   "webhooks",
+			object: map[string]interface{}{"webhooks": []interface{}{map[string]interface{}{"clientConfig": map[string]interface{}{}}}},
+			target: builtinTargets[Validating],
+			want:   encoded,
+		},
+		{
+			name:   "webhook without client config",
+			object: map[string]interface{}{"webhooks": []interface{}{map[string]interface{}{"name": "w"}}},
+			target: builtinTargets[Validating],
+			want:   encoded,
+		},
+		{
+			name:   "no webhooks",
+			object: map[string]interface{}{},
+			target: builtinTargets[Mutating],
+		},
+		{
+			name:    "missing conversion client config",
+			object:  map[string]interface{}{"spec": map[string]interface{}{}},
+			target:  builtinTargets[CRDConversion],
+			wantErr: true,
+		},
+		{
+			name:   "api service",
+			object: map[string]interface{}{"spec": map[string]interface{}{}},
+			target: builtinTargets[APIService],
+			field:  []string{"spec", "caBundle"},
+			want:   encoded,
+		},
+		{
+			name:   "config map without data",
+			object: map[string]interface{}{},
+			target: builtinTargets[ConfigMap],
+			field:  []string{"data", "ca.crt"},
+			want:   string(certPem),
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			u := &unstructured.Unstructured{Object: tt.object}
+			err := injectCert(u, certPem, tt.target)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.field == nil {
+				webhooks, _, _ := unstructured.NestedSlice(u.Object, "webhooks")
+				for _, w := range webhooks {
+					got, _, _ := unstructured.NestedString(w.(map[string]interface{}), "clientConfig", "caBundle")
+					if got != tt.want {
+						t.Errorf("got %q, want %q", got, tt.want)
+					}
+				}
+				return
+			}
+			got, _, _ := unstructured.NestedString(u.Object, tt.field...)
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenericWebhookTarget(t *testing.T) {
+	gvk := schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Provider"}
+	if _, err := (WebhookInfo{Name: "missing-gvk", Type: Generic, FieldPaths: []string{"spec.caBundle"}}).target(); err == nil {
+		t.Error("expected error for Generic webhook without GVK")
+	}
+	if _, err := (WebhookInfo{Name: "missing-path", Type: Generic, GVK: gvk}).target(); err == nil {
+		t.Error("expected error for Generic webhook without field paths")
+	}
+	if _, err := (WebhookInfo{Name: "bad-path", Type: Generic, GVK: gvk, FieldPaths: []string{"spec.caBundle", "spec..caBundle"}}).target(); err == nil {
+		t.Error("expected error for Generic webhook with a malformed field path")
+	}
+
+	wh := WebhookInfo{
+		Name:       "provider",
+		Type:       Generic,
+		GVK:        gvk,
+		FieldPaths: []string{"spec.caBundle", "spec.backends[*].tls.ca"},
+		Encoding:   PEMEncoding,
+	}
+	target, err := wh.target()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target.gvk != gvk {
+		t.Errorf("got gvk %v, want %v", target.gvk, gvk)
+	}
+
+	certPem := []byte("-----BEGIN CERTIFICATE-----\n-----END CERTIFICATE-----\n")
+	u := &unstructured.Unstructured{Object: map[string]interface{}{
+		"spec": map[string]interface{}{
+			"backends": []interface{}{
+				map[string]interface{}{"tls": map[string]interface{}{}},
+				map[string]interface{}{"tls": map[string]interface{}{}},
+			},
+		},
+	}}
+	if err := injectCert(u, certPem, target); err != nil {
+		t.Fatal(err)
+	}
+	if got, _, _ := unstructured.NestedString(u.Object, "spec", "caBundle"); got != string(certPem) {
+		t.Errorf("spec.caBundle: got %q, want %q", got, certPem)
+	}
+	backends, _, _ := unstructured.NestedSlice(u.Object, "spec", "backends")
+	for i, b := range backends {
+		if got, _, _ := unstructured.NestedString(b.(map[string]interface{}), "tls", "ca"); got != string(certPem) {
+			t.Errorf("backend %d: got %q, want %q", i, got, certPem)
+		}
+	}
+}
+
+func TestWebhookKey(t *testing.T) {
+	testCases := []struct {
+		name    string
+		webhook WebhookInfo
+		want    types.NamespacedName
+	}{
+		{
+			name:    "cluster-scoped",
+			webhook: WebhookInfo{Name: "vwh", Type: Validating},
+			want:    types.NamespacedName{Name: "vwh"},
+		},
+		{
+			name:    "configmap defaults to secret namespace",
+			webhook: WebhookInfo{Name: "ca", Type: ConfigMap},
+			want:    types.NamespacedName{Namespace: "secret-ns", Name: "ca"},
+		},
+		{
+			name:    "configmap in other namespace",
+			webhook: WebhookInfo{Name: "ca", Namespace: "other", Type: ConfigMap},
+			want:    types.NamespacedName{Namespace: "other", Name: "ca"},
+		},
+		{
+			name:    "namespaced generic",
+			webhook: WebhookInfo{Name: "rule", Namespace: "istio-system", Type: Generic},
+			want:    types.NamespacedName{Namespace: "istio-system", Name: "rule"},
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.webhook.key("secret-ns"); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := (WebhookInfo{Name: "vwh", Namespace: "other", Type: Validating}).target(); err == nil {
+		t.Error("expected error for namespaced cluster-scoped webhook")
+	}
+}
+
+func TestResolveGVK(t *testing.T) {
+	group := "externaldata.gatekeeper.sh"
+	mapper := meta.NewDefaultRESTMapper([]schema.GroupVersion{
+		{Group: group, Version: "v1beta1"},
+		{Group: group, Version: "v1alpha1"},
+	})
+	mapper.Add(schema.GroupVersionKind{Group: group, Version: "v1beta1", Kind: "Provider"}, meta.RESTScopeRoot)
+	mapper.Add(schema.GroupVersionKind{Group: group, Version: "v1alpha1", Kind: "Provider"}, meta.RESTScopeRoot)
+
+	testCases := []struct {
+		name    string
+		webhook WebhookInfo
+		want    string
+		wantErr bool
+	}{
+		{name: "preferred version", webhook: WebhookInfo{Name: "p", Type: ExternalDataProvider}, want: "v1beta1"},
+		{name: "pinned version", webhook: WebhookInfo{Name: "p", Type: ExternalDataProvider, Version: "v1alpha1"}, want: "v1alpha1"},
+		{name: "unserved version", webhook: WebhookInfo{Name: "p", Type: ExternalDataProvider, Version: "v1"}, wantErr: true},
+		{name: "unserved kind", webhook: WebhookInfo{Name: "p", Type: Generic, GVK: schema.GroupVersionKind{Group: "example.com", Kind: "Provider"}, FieldPaths: []string{"spec.caBundle"}}, wantErr: true},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			target, err := tt.webhook.target()
+			if err != nil {
+				t.Fatal(err)
+			}
+			gvk, err := target.resolveGVK(mapper)
+			if tt.wantErr {
+				if !meta.IsNoMatchError(err) {
+					t.Fatalf("expected NoMatch error, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if gvk.Version != tt.want {
+				t.Errorf("got version %s, want %s", gvk.Version, tt.want)
+			}
+		})
+	}
+}
+
+func TestCABundleMatches(t *testing.T) {
+	certPem := []byte("-----BEGIN CERTIFICATE-----\n-----END CERTIFICATE-----\n")
+	other := []byte("other")
+	target := builtinTargets[Validating]
+
+	u := &unstructured.Unstructured{Object: map[string]interface{}{}}
+	if !caBundleMatches(u, certPem, target) {
+		t.Error("expected a webhook configuration without webhooks to match")
+	}
+
+	u.Object["webhooks"] = []interface{}{
+		map[string]interface{}{"clientConfig": map[string]interface{}{}},
+		map[string]interface{}{"clientConfig": map[string]interface{}{}},
+	}
+	if caBundleMatches(u, certPem, target) {
+		t.Error("expected webhooks without a CA bundle not to match")
+	}
+	if err := injectCert(u, certPem, target); err != nil {
+		t.Fatal(err)
+	}
+	if !caBundleMatches(u, certPem, target) {
+		t.Error("expected injected webhooks to match")
+	}
+	if caBundleMatches(u, other, target) {
+		t.Error("expected webhooks not to match another CA bundle")
+	}
+
+	cm := &unstructured.Unstructured{Object: map[string]interface{}{}}
+	if err := injectCert(cm, certPem, builtinTargets[ConfigMap]); err != nil {
+		t.Fatal(err)
+	}
+	if !caBundleMatches(cm, certPem, builtinTargets[ConfigMap]) {
+		t.Error("expected injected ConfigMap to match")
+	}
+}
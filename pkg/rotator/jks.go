@@ -0,0 +1,121 @@
+package rotator
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rsa"
+	"crypto/x509"
+
+	"github.com/pavlo-v-chernykh/keystore-go/v4"
+	"github.com/pkg/errors"
+)
+
+const (
+	// jksServerAlias is the alias of the server cert and its private key in JKS keystores.
+	jksServerAlias = "server"
+	// jksCAAlias is the alias of the CA cert in JKS truststores.
+	jksCAAlias  = "ca"
+	jksCertType = "X509"
+)
+
+// encodeJKSKeystore encodes a JKS keystore holding the server cert, its private key and the
+// CA cert as a single entry.
+func encodeJKSKeystore(key *rsa.PrivateKey, cert, caCert *x509.Certificate, password string) ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "marshaling key")
+	}
+	ks := keystore.New()
+	entry := keystore.PrivateKeyEntry{
+		CreationTime: cert.NotBefore,
+		PrivateKey:   der,
+		CertificateChain: []keystore.Certificate{
+			{Type: jksCertType, Content: cert.Raw},
+			{Type: jksCertType, Content: caCert.Raw},
+		},
+	}
+	if err := ks.SetPrivateKeyEntry(jksServerAlias, entry, []byte(password)); err != nil {
+		return nil, err
+	}
+	return storeJKS(ks, password)
+}
+
+// encodeJKSTruststore encodes a JKS truststore holding the CA cert.
+func encodeJKSTruststore(caCert *x509.Certificate, password string) ([]byte, error) {
+	ks := keystore.New()
+	entry := keystore.TrustedCertificateEntry{
+		CreationTime: caCert.NotBefore,
+		Certificate:  keystore.Certificate{Type: jksCertType, Content: caCert.Raw},
+	}
+	if err := ks.SetTrustedCertificateEntry(jksCAAlias, entry); err != nil {
+		return nil, err
+	}
+	return storeJKS(ks, password)
+}
+
+func storeJKS(ks keystore.KeyStore, password string) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := ks.Store(&buf, []byte(password)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeJKSKeystore returns the private key, the cert and the CA certs of the server entry of
+// a JKS keystore.
+func decodeJKSKeystore(data []byte, password string) (crypto.PrivateKey, *x509.Certificate, []*x509.Certificate, error) {
+	ks, err := loadJKS(data, password)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	entry, err := ks.GetPrivateKeyEntry(jksServerAlias, []byte(password))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	key, err := x509.ParsePKCS8PrivateKey(entry.PrivateKey)
+	if err != nil {
+		return nil, nil, nil, errors.Wrap(err, "parsing key")
+	}
+	if len(entry.CertificateChain) == 0 {
+		return nil, nil, nil, errors.New("missing certificate chain")
+	}
+	certs := make([]*x509.Certificate, 0, len(entry.CertificateChain))
+	for _, c := range entry.CertificateChain {
+		cert, err := x509.ParseCertificate(c.Content)
+		if err != nil {
+			return nil, nil, nil, errors.Wrap(err, "parsing certificate")
+		}
+		certs = append(certs, cert)
+	}
+	return key, certs[0], certs[1:], nil
+}
+
+// decodeJKSTruststore returns the trusted certs of a JKS truststore.
+func decodeJKSTruststore(data []byte, password string) ([]*x509.Certificate, error) {
+	ks, err := loadJKS(data, password)
+	if err != nil {
+		return nil, err
+	}
+	var certs []*x509.Certificate
+	for _, alias := range ks.Aliases() {
+		entry, err := ks.GetTrustedCertificateEntry(alias)
+		if err != nil {
+			return nil, err
+		}
+		cert, err := x509.ParseCertificate(entry.Certificate.Content)
+		if err != nil {
+			return nil, errors.Wrap(err, "parsing certificate")
+		}
+		certs = append(certs, cert)
+	}
+	return certs, nil
+}
+
+// loadJKS loads a JKS keystore, verifying its integrity with the password.
+func loadJKS(data []byte, password string) (keystore.KeyStore, error) {
+	ks := keystore.New()
+	if err := ks.Load(bytes.NewReader(data), []byte(password)); err != nil {
+		return keystore.KeyStore{}, err
+	}
+	return ks, nil
+}
@@ -0,0 +1,129 @@
+package rotator
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// KeyProtector encrypts the CA private key before it is stored in a secret and decrypts it
+// when it is read, so that the CA key is not stored in plaintext in etcd. Implementations may
+// use a local key, see NewFileKeyProtector, or an external key management service, e.g. a
+// Kubernetes KMS v2 plugin over its Unix socket.
+type KeyProtector interface {
+	// Protect returns the encrypted PEM encoded key.
+	Protect(ctx context.Context, key []byte) ([]byte, error)
+	// Unprotect returns the PEM encoded key of the encrypted key.
+	Unprotect(ctx context.Context, protected []byte) ([]byte, error)
+}
+
+type fileKeyProtector struct {
+	aead cipher.AEAD
+}
+
+// NewFileKeyProtector returns a KeyProtector encrypting the CA key with AES-GCM, using the
+// base64 encoded 16, 24 or 32 byte key of the file, e.g. mounted from a secret that is not
+// readable by the webhook pods. The file is only read once.
+func NewFileKeyProtector(path string) (KeyProtector, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading encryption key: %w", err)
+	}
+	key, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(data)))
+	if err != nil {
+		return nil, fmt.Errorf("decoding encryption key: %w", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid encryption key: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("creating AES-GCM cipher: %w", err)
+	}
+	return &fileKeyProtector{aead: aead}, nil
+}
+
+// Protect returns the nonce followed by the sealed key.
+func (p *fileKeyProtector) Protect(_ context.Context, key []byte) ([]byte, error) {
+	nonce := make([]byte, p.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, errors.Wrap(err, "generating nonce")
+	}
+	return p.aead.Seal(nonce, nonce, key, nil), nil
+}
+
+func (p *fileKeyProtector) Unprotect(_ context.Context, protected []byte) ([]byte, error) {
+	if len(protected) < p.aead.NonceSize() {
+		return nil, errors.New("encrypted key is too short")
+	}
+	nonce, sealed := protected[:p.aead.NonceSize()], protected[p.aead.NonceSize():]
+	key, err := p.aead.Open(nil, nonce, sealed, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "decrypting key")
+	}
+	return key, nil
+}
+
+// plaintextCAKey returns true if the CA key of the secret is stored in plaintext although
+// a KeyProtector is set, e.g. because it was stored before the KeyProtector was set.
+func (cr *CertRotator) plaintextCAKey(secret *corev1.Secret) bool {
+	return cr.KeyProtector != nil && isPEM(secret.Data[caKeyName])
+}
+
+// caKeyPEM returns the PEM encoded CA key of the secret, decrypted by the KeyProtector.
+// A CA key stored in plaintext is returned as is, so that it is encrypted when the secret
+// is next written rather than rotated.
+func (cr *CertRotator) caKeyPEM(secret *corev1.Secret) ([]byte, error) {
+	key := secret.Data[caKeyName]
+	if cr.KeyProtector == nil || key == nil || isPEM(key) {
+		return key, nil
+	}
+	key, err := cr.KeyProtector.Unprotect(context.Background(), key)
+	if err != nil {
+		return nil, errors.Wrap(err, "unprotecting CA key")
+	}
+	return key, nil
+}
+
+// protectCAKey sets the CA key in the secret, encrypted by the KeyProtector.
+func (cr *CertRotator) protectCAKey(caArtifacts *KeyPairArtifacts, secret *corev1.Secret) error {
+	key := caArtifacts.KeyPEM
+	if cr.KeyProtector != nil {
+		var err error
+		key, err = cr.KeyProtector.Protect(context.Background(), key)
+		if err != nil {
+			return errors.Wrap(err, "protecting CA key")
+		}
+	}
+	secret.Data[caKeyName] = key
+	return nil
+}
+
+// caArtifacts builds the CA from the secret, decrypting its key with the KeyProtector.
+func (cr *CertRotator) caArtifacts(secret *corev1.Secret) (*KeyPairArtifacts, error) {
+	key, err := cr.caKeyPEM(secret)
+	if err != nil {
+		return nil, err
+	}
+	if key == nil {
+		return buildArtifactsFromSecret(secret)
+	}
+	return buildArtifactsFromSecret(&corev1.Secret{Data: map[string][]byte{
+		caCertName: secret.Data[caCertName],
+		caKeyName:  key,
+	}})
+}
+
+func isPEM(data []byte) bool {
+	return bytes.HasPrefix(data, []byte("-----BEGIN "))
+}
@@ -0,0 +1,246 @@
+package rotator
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+const (
+	defaultKeystoreName      = "keystore.p12"
+	defaultTruststoreName    = "truststore.p12"
+	defaultJKSKeystoreName   = "keystore.jks"
+	defaultJKSTruststoreName = "truststore.jks"
+	defaultPasswordKey       = "password"
+)
+
+// KeystoreFormat is the format of the keystores of the server cert.
+type KeystoreFormat string
+
+const (
+	// PKCS12 keystores are read by JVMs since Java 9, and by most other servers.
+	PKCS12 KeystoreFormat = "PKCS12"
+	// JKS keystores are read by JVMs before Java 9.
+	JKS KeystoreFormat = "JKS"
+)
+
+// Keystore configures keystores of the server cert for servers that do not load PEM files,
+// such as JVM servers. They are stored in the secret of the CertRotator along with the server
+// cert, and regenerated along with it, or from it when their password changes.
+type Keystore struct {
+	// Format is the format of the keystores. Defaults to PKCS12.
+	Format KeystoreFormat
+	// KeystoreName is the key of the keystore holding the server cert, its private key and
+	// the CA cert in the secret. Defaults to keystore.p12, or keystore.jks for JKS.
+	KeystoreName string
+	// TruststoreName is the key of the truststore holding the CA cert in the secret.
+	// Defaults to truststore.p12, or truststore.jks for JKS.
+	TruststoreName string
+	// PasswordSecretKey is the secret holding the password of the keystores. It must exist,
+	// and its namespace defaults to the namespace of the secret of the CertRotator.
+	PasswordSecretKey types.NamespacedName
+	// PasswordKey is the key of the password in its secret. Defaults to password.
+	PasswordKey string
+}
+
+// validateKeystore sets the defaults of the keystores, and returns an error if they are
+// stored under the key of another cert.
+func (cr *CertRotator) validateKeystore() error {
+	ks := cr.Keystore
+	keystoreName, truststoreName := defaultKeystoreName, defaultTruststoreName
+	switch ks.Format {
+	case "":
+		ks.Format = PKCS12
+	case PKCS12:
+	case JKS:
+		keystoreName, truststoreName = defaultJKSKeystoreName, defaultJKSTruststoreName
+	default:
+		return fmt.Errorf("invalid keystore format %s", ks.Format)
+	}
+	if ks.KeystoreName == "" {
+		ks.KeystoreName = keystoreName
+	}
+	if ks.TruststoreName == "" {
+		ks.TruststoreName = truststoreName
+	}
+	if ks.PasswordKey == "" {
+		ks.PasswordKey = defaultPasswordKey
+	}
+	if ks.PasswordSecretKey.Namespace == "" {
+		ks.PasswordSecretKey.Namespace = cr.SecretKey.Namespace
+	}
+	if ks.PasswordSecretKey.Name == "" {
+		return fmt.Errorf("invalid secret for keystore password")
+	}
+	reserved := map[string]bool{caCertName: true, caKeyName: true, cr.CertName: true, cr.KeyName: true}
+	for _, leaf := range cr.leafCerts() {
+		if leaf.secretKey == cr.SecretKey {
+			reserved[leaf.certName] = true
+			reserved[leaf.keyName] = true
+		}
+	}
+	if ks.KeystoreName == ks.TruststoreName || reserved[ks.KeystoreName] || reserved[ks.TruststoreName] {
+		return fmt.Errorf("keystores cannot be stored under %s and %s, which hold other certs", ks.KeystoreName, ks.TruststoreName)
+	}
+	return nil
+}
+
+// keystorePassword reads the password of the keystores.
+func (cr *CertRotator) keystorePassword() (string, error) {
+	secret := &corev1.Secret{}
+	if err := cr.apiReader.Get(context.Background(), cr.Keystore.PasswordSecretKey, secret); err != nil {
+		return "", errors.Wrap(err, "acquiring keystore password secret")
+	}
+	password, ok := secret.Data[cr.Keystore.PasswordKey]
+	if !ok {
+		return "", errors.New(fmt.Sprintf("keystore password secret is not well-formed, missing %s", cr.Keystore.PasswordKey))
+	}
+	return string(password), nil
+}
+
+// populateKeystores sets the keystores of the server cert in the secret.
+func (cr *CertRotator) populateKeystores(cert, key, caCert []byte, secret *corev1.Secret) error {
+	password, err := cr.keystorePassword()
+	if err != nil {
+		return err
+	}
+	crt, err := parseCertPEM(cert)
+	if err != nil {
+		return err
+	}
+	ca, err := parseCertPEM(caCert)
+	if err != nil {
+		return err
+	}
+	privateKey, err := parseKeyPEM(key)
+	if err != nil {
+		return err
+	}
+	keystore, err := cr.Keystore.encodeKeystore(privateKey, crt, ca, password)
+	if err != nil {
+		return errors.Wrap(err, "encoding keystore")
+	}
+	truststore, err := cr.Keystore.encodeTruststore(ca, password)
+	if err != nil {
+		return errors.Wrap(err, "encoding truststore")
+	}
+	secret.Data[cr.Keystore.KeystoreName] = keystore
+	secret.Data[cr.Keystore.TruststoreName] = truststore
+	return nil
+}
+
+// validKeystores returns true if the keystores of the secret can be opened with the current
+// password, and hold the server cert, its key and the CA cert of the secret.
+func (cr *CertRotator) validKeystores(secret *corev1.Secret) bool {
+	password, err := cr.keystorePassword()
+	if err != nil {
+		crLog.Error(err, "could not verify keystores")
+		return false
+	}
+	cert, err := parseCertPEM(secret.Data[cr.CertName])
+	if err != nil {
+		return false
+	}
+	caCert, err := parseCertPEM(secret.Data[caCertName])
+	if err != nil {
+		return false
+	}
+
+	privateKey, crt, caCerts, err := cr.Keystore.decodeKeystore(secret.Data[cr.Keystore.KeystoreName], password)
+	if err != nil {
+		crLog.Info("keystore cannot be decoded", "reason", err.Error())
+		return false
+	}
+	rsaKey, ok := privateKey.(*rsa.PrivateKey)
+	if !ok || !crt.Equal(cert) || !rsaKey.PublicKey.Equal(cert.PublicKey) || len(caCerts) != 1 || !caCerts[0].Equal(caCert) {
+		crLog.Info("keystore differs from the server cert")
+		return false
+	}
+	trusted, err := cr.Keystore.decodeTruststore(secret.Data[cr.Keystore.TruststoreName], password)
+	if err != nil {
+		crLog.Info("truststore cannot be decoded", "reason", err.Error())
+		return false
+	}
+	if len(trusted) != 1 || !trusted[0].Equal(caCert) {
+		crLog.Info("truststore differs from the CA cert")
+		return false
+	}
+	return true
+}
+
+// validEncodings returns true if the secret holds valid keystores and outputs of its server
+// cert, if they are configured.
+func (cr *CertRotator) validEncodings(secret *corev1.Secret) bool {
+	if cr.OutputFormats != nil && !cr.validOutputs(secret) {
+		return false
+	}
+	return cr.Keystore == nil || cr.validKeystores(secret)
+}
+
+// refreshEncodings re-encodes the keystores and outputs of the server cert of the secret from
+// its server cert, key and CA cert, without re-issuing the server cert.
+func (cr *CertRotator) refreshEncodings(secret *corev1.Secret) error {
+	cert, key, caCert := secret.Data[cr.CertName], secret.Data[cr.KeyName], secret.Data[caCertName]
+	if cr.OutputFormats != nil {
+		populateOutputs(cr.OutputFormats, cert, key, caCert, secret)
+	}
+	if cr.Keystore != nil {
+		if err := cr.populateKeystores(cert, key, caCert, secret); err != nil {
+			return err
+		}
+	}
+	return cr.writer.Update(context.Background(), secret)
+}
+
+// encodeKeystore encodes the keystore of the server cert, its private key and the CA cert.
+func (ks *Keystore) encodeKeystore(key *rsa.PrivateKey, cert, caCert *x509.Certificate, password string) ([]byte, error) {
+	if ks.Format == JKS {
+		return encodeJKSKeystore(key, cert, caCert, password)
+	}
+	return pkcs12.Modern.Encode(key, cert, []*x509.Certificate{caCert}, password)
+}
+
+// encodeTruststore encodes the truststore of the CA cert.
+func (ks *Keystore) encodeTruststore(caCert *x509.Certificate, password string) ([]byte, error) {
+	if ks.Format == JKS {
+		return encodeJKSTruststore(caCert, password)
+	}
+	return pkcs12.Modern.EncodeTrustStore([]*x509.Certificate{caCert}, password)
+}
+
+// decodeKeystore returns the private key, the cert and the CA certs of the keystore.
+func (ks *Keystore) decodeKeystore(data []byte, password string) (crypto.PrivateKey, *x509.Certificate, []*x509.Certificate, error) {
+	if ks.Format == JKS {
+		return decodeJKSKeystore(data, password)
+	}
+	return pkcs12.DecodeChain(data, password)
+}
+
+// decodeTruststore returns the certs of the truststore.
+func (ks *Keystore) decodeTruststore(data []byte, password string) ([]*x509.Certificate, error) {
+	if ks.Format == JKS {
+		return decodeJKSTruststore(data, password)
+	}
+	return pkcs12.DecodeTrustStore(data, password)
+}
+
+// parseKeyPEM parses a PEM encoded PKCS#1 RSA private key.
+func parseKeyPEM(key []byte) (*rsa.PrivateKey, error) {
+	b, _ := pem.Decode(key)
+	if b == nil {
+		return nil, errors.New("bad key")
+	}
+	privateKey, err := x509.ParsePKCS1PrivateKey(b.Bytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing key")
+	}
+	return privateKey, nil
+}
@@ -0,0 +1,167 @@
+package rotator
+
+import (
+	"bytes"
+	"context"
+	"crypto/rsa"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+func TestKeystores(t *testing.T) {
+	ctx := context.Background()
+	passwordKey := types.NamespacedName{Namespace: "ns", Name: "password"}
+	password := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: passwordKey.Namespace, Name: passwordKey.Name},
+		Data:       map[string][]byte{defaultPasswordKey: []byte("changeit")},
+	}
+	rotator, c := newTestRotator(t, password)
+	rotator.Keystore = &Keystore{PasswordSecretKey: types.NamespacedName{Name: passwordKey.Name}}
+	if err := rotator.validateKeystore(); err != nil {
+		t.Fatal(err)
+	}
+	if rotator.Keystore.PasswordSecretKey != passwordKey {
+		t.Errorf("got password secret %s", rotator.Keystore.PasswordSecretKey)
+	}
+
+	secret := refreshSecret(t, rotator)
+	_, crt, caCerts, err := pkcs12.DecodeChain(secret.Data[defaultKeystoreName], "changeit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := parseCertPEM(secret.Data[defaultCertName])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !crt.Equal(cert) || len(caCerts) != 1 {
+		t.Error("expected the keystore to hold the server cert and the CA cert")
+	}
+	trusted, err := pkcs12.DecodeTrustStore(secret.Data[defaultTruststoreName], "changeit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trusted) != 1 || !trusted[0].Equal(caCerts[0]) {
+		t.Error("expected the truststore to hold the CA cert")
+	}
+
+	// The keystores are kept while they are valid.
+	if refreshed := refreshSecret(t, rotator); refreshed.ResourceVersion != secret.ResourceVersion {
+		t.Error("expected the secret not to be updated")
+	}
+
+	// The keystores are regenerated from the server cert when the password changes.
+	serverCert := secret.Data[defaultCertName]
+	password.Data[defaultPasswordKey] = []byte("changed")
+	if err := c.Update(ctx, password); err != nil {
+		t.Fatal(err)
+	}
+	secret = refreshSecret(t, rotator)
+	if _, err := pkcs12.DecodeTrustStore(secret.Data[defaultTruststoreName], "changed"); err != nil {
+		t.Errorf("expected the truststore to be regenerated with the new password: %v", err)
+	}
+	if !rotator.validKeystores(secret) {
+		t.Error("expected the keystores to be valid")
+	}
+	if !bytes.Equal(secret.Data[defaultCertName], serverCert) {
+		t.Error("expected the server cert not to be re-issued")
+	}
+
+	// The keystores are regenerated when they are missing.
+	delete(secret.Data, defaultKeystoreName)
+	if err := c.Update(ctx, secret); err != nil {
+		t.Fatal(err)
+	}
+	if secret = refreshSecret(t, rotator); !rotator.validKeystores(secret) || !bytes.Equal(secret.Data[defaultCertName], serverCert) {
+		t.Error("expected the keystores to be regenerated from the server cert")
+	}
+}
+
+func TestJKSKeystores(t *testing.T) {
+	ctx := context.Background()
+	password := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "password"},
+		Data:       map[string][]byte{defaultPasswordKey: []byte("changeit")},
+	}
+	rotator, c := newTestRotator(t, password)
+	rotator.Keystore = &Keystore{Format: JKS, PasswordSecretKey: types.NamespacedName{Name: password.Name}}
+	if err := rotator.validateKeystore(); err != nil {
+		t.Fatal(err)
+	}
+
+	secret := refreshSecret(t, rotator)
+	key, crt, caCerts, err := decodeJKSKeystore(secret.Data[defaultJKSKeystoreName], "changeit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := parseCertPEM(secret.Data[defaultCertName])
+	if err != nil {
+		t.Fatal(err)
+	}
+	caCert, err := parseCertPEM(secret.Data[caCertName])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rsaKey, ok := key.(*rsa.PrivateKey); !ok || !rsaKey.PublicKey.Equal(cert.PublicKey) {
+		t.Error("expected the keystore to hold the key of the server cert")
+	}
+	if !crt.Equal(cert) || len(caCerts) != 1 || !caCerts[0].Equal(caCert) {
+		t.Error("expected the keystore to hold the server cert and the CA cert")
+	}
+	trusted, err := decodeJKSTruststore(secret.Data[defaultJKSTruststoreName], "changeit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trusted) != 1 || !trusted[0].Equal(caCert) {
+		t.Error("expected the truststore to hold the CA cert")
+	}
+	if _, err := decodeJKSTruststore(secret.Data[defaultJKSTruststoreName], "wrong"); err == nil {
+		t.Error("expected an error decoding the truststore with another password")
+	}
+
+	// The keystores are kept while they are valid.
+	if refreshed := refreshSecret(t, rotator); refreshed.ResourceVersion != secret.ResourceVersion {
+		t.Error("expected the secret not to be updated")
+	}
+
+	// The keystores are regenerated from the server cert when the password changes.
+	password.Data[defaultPasswordKey] = []byte("changed")
+	if err := c.Update(ctx, password); err != nil {
+		t.Fatal(err)
+	}
+	refreshed := refreshSecret(t, rotator)
+	if !rotator.validKeystores(refreshed) || !bytes.Equal(refreshed.Data[defaultCertName], secret.Data[defaultCertName]) {
+		t.Error("expected the keystores to be regenerated from the server cert")
+	}
+}
+
+func TestValidateKeystore(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		keystore Keystore
+		wantErr  bool
+	}{
+		{name: "defaults", keystore: Keystore{PasswordSecretKey: types.NamespacedName{Name: "password"}}},
+		{name: "JKS", keystore: Keystore{Format: JKS, PasswordSecretKey: types.NamespacedName{Name: "password"}}},
+		{name: "invalid format", keystore: Keystore{Format: "PEM", PasswordSecretKey: types.NamespacedName{Name: "password"}}, wantErr: true},
+		{name: "missing password secret", keystore: Keystore{}, wantErr: true},
+		{name: "cert name", keystore: Keystore{KeystoreName: defaultCertName, PasswordSecretKey: types.NamespacedName{Name: "password"}}, wantErr: true},
+		{name: "same names", keystore: Keystore{KeystoreName: "ks", TruststoreName: "ks", PasswordSecretKey: types.NamespacedName{Name: "password"}}, wantErr: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			keystore := tc.keystore
+			cr := &CertRotator{
+				SecretKey: types.NamespacedName{Namespace: "ns", Name: "secret"},
+				CertName:  defaultCertName,
+				KeyName:   defaultKeyName,
+				Keystore:  &keystore,
+			}
+			if err := cr.validateKeystore(); (err != nil) != tc.wantErr {
+				t.Errorf("got error %v, want error %v", err, tc.wantErr)
+			}
+		})
+	}
+}
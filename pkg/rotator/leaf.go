@@ -0,0 +1,283 @@
+package rotator
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"net"
+	"net/url"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// ServerCert is an additional server certificate issued by the CA of the CertRotator, e.g. for
+// another webhook server or an aggregated API server, so that all of them trust a single CA
+// and are rotated together.
+type ServerCert struct {
+	// SecretKey is the secret the server cert is stored in, under CertName and KeyName along
+	// with the CA cert under ca.crt. Like the secret of the CertRotator, it must exist.
+	// Defaults to the secret of the CertRotator.
+	SecretKey types.NamespacedName
+	// CertName and KeyName are the keys of the server cert and its private key in the secret.
+	// They default to the CertName and KeyName of the CertRotator, and must differ from them
+	// when the server cert is stored in the secret of the CertRotator.
+	CertName string
+	KeyName  string
+	// CertDir is the optional directory the secret is mounted in. The mounted server cert
+	// is verified by CheckCerts.
+	CertDir string
+	// DNSName, ExtraDNSNames, Services, IPAddresses, URIs and EmailAddresses are the subject
+	// alternative names of the server cert, as for the server cert of the CertRotator.
+	DNSName        string
+	ExtraDNSNames  []string
+	Services       []types.NamespacedName
+	IPAddresses    []net.IP
+	URIs           []*url.URL
+	EmailAddresses []string
+	// Subject is the optional subject of the server cert. Its CommonName defaults to DNSName,
+	// or to the first DNS name of the server cert.
+	Subject *pkix.Name
+	// ExtKeyUsages defaults to the ExtKeyUsages of the CertRotator.
+	ExtKeyUsages *[]x509.ExtKeyUsage
+	// Duration sets how long the server cert will be valid for. Defaults to ServerCertDuration.
+	Duration time.Duration
+}
+
+// leafCert is a cert issued by the CA other than the server cert of the CertRotator.
+type leafCert struct {
+	// kind is the kind of the cert in logs.
+	kind      string
+	secretKey types.NamespacedName
+	certName  string
+	keyName   string
+	certDir   string
+	spec      certSpec
+	duration  time.Duration
+	// dnsName is the DNS name the cert is verified for, if any.
+	dnsName string
+}
+
+// serverLeafCert returns the leaf cert of an additional server cert, with the defaults of the CertRotator.
+func (cr *CertRotator) serverLeafCert(serverCert ServerCert) leafCert {
+	leaf := leafCert{
+		kind:      "server",
+		secretKey: serverCert.SecretKey,
+		certName:  serverCert.CertName,
+		keyName:   serverCert.KeyName,
+		certDir:   serverCert.CertDir,
+		duration:  serverCert.Duration,
+	}
+	if leaf.secretKey == (types.NamespacedName{}) {
+		leaf.secretKey = cr.SecretKey
+	}
+	if leaf.certName == "" {
+		leaf.certName = cr.CertName
+	}
+	if leaf.keyName == "" {
+		leaf.keyName = cr.KeyName
+	}
+	if leaf.duration == 0 {
+		leaf.duration = cr.ServerCertDuration
+	}
+
+	leaf.spec = certSpec{
+		dnsNames:       dnsNames(cr.ClusterDomain, serverCert.DNSName, serverCert.ExtraDNSNames, serverCert.Services),
+		ipAddresses:    serverCert.IPAddresses,
+		uris:           serverCert.URIs,
+		emailAddresses: serverCert.EmailAddresses,
+		keyUsage:       x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		keyAlgorithm:   x509.RSA,
+		keySize:        rsaKeySize,
+	}
+	if serverCert.Subject != nil {
+		leaf.spec.subject = *serverCert.Subject
+	}
+	if leaf.spec.subject.CommonName == "" {
+		leaf.spec.subject.CommonName = serverCert.DNSName
+	}
+	if len(leaf.spec.dnsNames) > 0 {
+		leaf.dnsName = leaf.spec.dnsNames[0]
+		if leaf.spec.subject.CommonName == "" {
+			leaf.spec.subject.CommonName = leaf.dnsName
+		}
+	}
+	switch {
+	case serverCert.ExtKeyUsages != nil:
+		leaf.spec.extKeyUsages = *serverCert.ExtKeyUsages
+	case cr.ExtKeyUsages != nil:
+		leaf.spec.extKeyUsages = *cr.ExtKeyUsages
+	}
+	if leaf.duration != 0 {
+		leaf.spec.validity = leaf.duration + certBackdate
+	}
+	return leaf
+}
+
+// clientLeafCert returns the leaf cert of a client cert, with the defaults of the CertRotator.
+func (cr *CertRotator) clientLeafCert(clientCert ClientCert) leafCert {
+	duration := clientCert.Duration
+	if duration == 0 {
+		duration = cr.ServerCertDuration
+	}
+	return leafCert{
+		kind:      "client",
+		secretKey: clientCert.SecretKey,
+		certName:  cr.CertName,
+		keyName:   cr.KeyName,
+		spec:      cr.clientCertSpec(clientCert),
+		duration:  duration,
+	}
+}
+
+// leafCerts returns the additional server certs and the client certs.
+func (cr *CertRotator) leafCerts() []leafCert {
+	leaves := make([]leafCert, 0, len(cr.ServerCerts)+len(cr.ClientCerts))
+	for _, serverCert := range cr.ServerCerts {
+		leaves = append(leaves, cr.serverLeafCert(serverCert))
+	}
+	for _, clientCert := range cr.ClientCerts {
+		leaves = append(leaves, cr.clientLeafCert(clientCert))
+	}
+	return leaves
+}
+
+// otherSecretKeys returns the secrets other than the secret of the CertRotator that are
+// cached and watched: the secrets of the leaf certs. The secret of the CA is only read from
+// the API server, so that the CA key is not cached by every replica, and so is the secret of
+// the keystore password, which is only read when the keystores are checked.
+func (cr *CertRotator) otherSecretKeys() []types.NamespacedName {
+	var keys []types.NamespacedName
+	seen := sets.New(cr.SecretKey, cr.CASecretKey)
+	for _, leaf := range cr.leafCerts() {
+		if !seen.Has(leaf.secretKey) {
+			seen.Insert(leaf.secretKey)
+			keys = append(keys, leaf.secretKey)
+		}
+	}
+	return keys
+}
+
+// validateLeafCerts returns an error if a leaf cert is stored in an invalid secret, or under
+// the same key of a secret as another cert.
+func (cr *CertRotator) validateLeafCerts() error {
+	type secretEntry struct {
+		secret types.NamespacedName
+		name   string
+	}
+	// The CA cert is stored in every secret, while its key is only stored in the secret of the CertRotator.
+	entries := sets.New(
+		secretEntry{cr.SecretKey, caKeyName},
+		secretEntry{cr.SecretKey, cr.CertName},
+		secretEntry{cr.SecretKey, cr.KeyName},
+	)
+	for i, leaf := range cr.leafCerts() {
+		if leaf.secretKey.Namespace == "" || leaf.secretKey.Name == "" {
+			return fmt.Errorf("invalid secret for %s cert %d", leaf.kind, i)
+		}
+		if leaf.secretKey == cr.CASecretKey {
+			return fmt.Errorf("%s cert %d cannot be stored in the secret of the CA", leaf.kind, i)
+		}
+		for _, name := range []string{leaf.certName, leaf.keyName} {
+			entry := secretEntry{leaf.secretKey, name}
+			if name == caCertName || entries.Has(entry) {
+				return fmt.Errorf("%s cert %d cannot be stored under %s of secret %s, which holds another cert", leaf.kind, i, name, leaf.secretKey)
+			}
+			entries.Insert(entry)
+		}
+	}
+	for i, serverCert := range cr.ServerCerts {
+		if err := validateSANs(serverCert.IPAddresses, serverCert.URIs, serverCert.EmailAddresses, cr.CANameConstraints); err != nil {
+			return fmt.Errorf("invalid server cert %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// validLeafCert returns true if the leaf cert is valid for the CA cert and matches its desired spec.
+func (cr *CertRotator) validLeafCert(leaf leafCert, caCert, cert, key []byte) bool {
+	valid, err := ValidCert(caCert, cert, key, leaf.dnsName, &leaf.spec.extKeyUsages, cr.lookaheadTime())
+	if err != nil || !valid {
+		return false
+	}
+	crt, err := parseCertPEM(cert)
+	if err != nil {
+		return false
+	}
+	if changed := leaf.spec.changed(crt); changed != "" {
+		crLog.Info(leaf.kind+" cert differs from its desired spec", "secret", leaf.secretKey, "attribute", changed)
+		return false
+	}
+	return true
+}
+
+// refreshLeafCertsIfNeeded issues the leaf certs that are not valid for the CA of the secret,
+// e.g. because the CA was rotated.
+func (cr *CertRotator) refreshLeafCertsIfNeeded() error {
+	secret := &corev1.Secret{}
+	if err := cr.apiReader.Get(context.Background(), cr.caSecretKey(), secret); err != nil {
+		return errors.Wrap(err, "acquiring CA secret to update leaf certificates")
+	}
+	caArtifacts, err := cr.caArtifacts(secret)
+	if err != nil {
+		return errors.Wrap(err, "building CA from secret to update leaf certificates")
+	}
+	for _, leaf := range cr.leafCerts() {
+		if err := cr.refreshLeafCertIfNeeded(leaf, caArtifacts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// refreshLeafCertIfNeeded issues the leaf cert if it is not valid for the CA. The CA key is
+// never written to the secret of the leaf cert.
+func (cr *CertRotator) refreshLeafCertIfNeeded(leaf leafCert, caArtifacts *KeyPairArtifacts) error {
+	log := crLog.WithValues("secret", leaf.secretKey, "cert", leaf.certName)
+	refreshFn := func() (bool, error) {
+		secret := &corev1.Secret{}
+		if err := cr.apiReader.Get(context.Background(), leaf.secretKey, secret); err != nil {
+			return false, errors.Wrapf(err, "acquiring secret to update %s certificate", leaf.kind)
+		}
+		if bytes.Equal(secret.Data[caCertName], caArtifacts.CertPEM) &&
+			cr.validLeafCert(leaf, caArtifacts.CertPEM, secret.Data[leaf.certName], secret.Data[leaf.keyName]) {
+			return true, nil
+		}
+
+		log.Info("refreshing " + leaf.kind + " cert")
+		now := time.Now()
+		cert, key, err := createCertPEM(caArtifacts, leaf.spec, now.Add(-certBackdate), now.Add(leaf.duration))
+		if err != nil {
+			return false, err
+		}
+		if secret.Data == nil {
+			secret.Data = make(map[string][]byte)
+		}
+		secret.Data[caCertName] = caArtifacts.CertPEM
+		secret.Data[leaf.certName] = cert
+		secret.Data[leaf.keyName] = key
+		if err := cr.writer.Update(context.Background(), secret); err != nil {
+			if k8sErrors.IsConflict(err) {
+				log.Info("secret was updated concurrently, re-checking " + leaf.kind + " cert")
+				return false, nil
+			}
+			log.Error(err, "could not refresh "+leaf.kind+" cert")
+			return false, nil
+		}
+		log.Info(leaf.kind + " cert refreshed")
+		return true, nil
+	}
+	return wait.ExponentialBackoff(wait.Backoff{
+		Duration: 10 * time.Millisecond,
+		Factor:   2,
+		Jitter:   1,
+		Steps:    10,
+	}, refreshFn)
+}
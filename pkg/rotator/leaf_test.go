@@ -0,0 +1,145 @@
+package rotator
+
+import (
+	"bytes"
+	"context"
+	"net/url"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestRefreshServerCerts(t *testing.T) {
+	ctx := context.Background()
+	apiKey := types.NamespacedName{Namespace: "ns", Name: "api"}
+	rotator, c := newTestRotator(t, &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: apiKey.Namespace, Name: apiKey.Name}})
+	rotator.DNSName = "webhook.ns.svc"
+	rotator.CANameConstraints = true
+	rotator.ServerCerts = []ServerCert{
+		{CertName: "metrics.crt", KeyName: "metrics.key", DNSName: "metrics.ns.svc"},
+		{SecretKey: apiKey, Services: []types.NamespacedName{{Namespace: "ns", Name: "api"}}},
+	}
+	if err := rotator.validateLeafCerts(); err != nil {
+		t.Fatal(err)
+	}
+
+	secrets, _ := refreshSecrets(t, rotator, apiKey)
+	secret, apiSecret := secrets[0], secrets[1]
+	caCert := secret.Data[caCertName]
+	if !rotator.validServerCert(caCert, secret.Data[rotator.CertName], secret.Data[rotator.KeyName]) {
+		t.Error("expected the server cert to be kept along with the additional server cert")
+	}
+	metrics := rotator.serverLeafCert(rotator.ServerCerts[0])
+	if !rotator.validLeafCert(metrics, caCert, secret.Data["metrics.crt"], secret.Data["metrics.key"]) {
+		t.Error("expected the additional server cert in the secret to be valid for the CA")
+	}
+	api := rotator.serverLeafCert(rotator.ServerCerts[1])
+	if api.dnsName != "api" {
+		t.Errorf("got DNS name %s", api.dnsName)
+	}
+	if !bytes.Equal(apiSecret.Data[caCertName], caCert) {
+		t.Error("expected the secret of the additional server cert to hold the CA cert")
+	}
+	if _, ok := apiSecret.Data[caKeyName]; ok {
+		t.Error("expected the secret of the additional server cert not to hold the CA key")
+	}
+	apiCert := apiSecret.Data[rotator.CertName]
+	if !rotator.validLeafCert(api, caCert, apiCert, apiSecret.Data[rotator.KeyName]) {
+		t.Fatal("expected the additional server cert to be valid for the CA")
+	}
+
+	// The server certs are kept while they are valid.
+	secrets, _ = refreshSecrets(t, rotator, apiKey)
+	if secrets[1].ResourceVersion != apiSecret.ResourceVersion {
+		t.Error("expected the secret of the additional server cert not to be updated")
+	}
+
+	// The server certs are re-issued along with the CA.
+	delete(secret.Data, caCertName)
+	if err := c.Update(ctx, secret); err != nil {
+		t.Fatal(err)
+	}
+	secrets, _ = refreshSecrets(t, rotator, apiKey)
+	secret, refreshed := secrets[0], secrets[1]
+	if !bytes.Equal(refreshed.Data[caCertName], secret.Data[caCertName]) || bytes.Equal(refreshed.Data[rotator.CertName], apiCert) {
+		t.Error("expected the additional server cert to be re-issued by the rotated CA")
+	}
+	if !rotator.validLeafCert(metrics, secret.Data[caCertName], secret.Data["metrics.crt"], secret.Data["metrics.key"]) {
+		t.Error("expected the additional server cert in the secret to be re-issued by the rotated CA")
+	}
+}
+
+func TestValidateLeafCerts(t *testing.T) {
+	key := types.NamespacedName{Namespace: "ns", Name: "secret"}
+	other := types.NamespacedName{Namespace: "ns", Name: "other"}
+	for _, tc := range []struct {
+		name            string
+		serverCerts     []ServerCert
+		clientCerts     []ClientCert
+		nameConstraints bool
+		wantErr         bool
+	}{
+		{
+			name:        "separate secrets",
+			serverCerts: []ServerCert{{SecretKey: other}},
+			clientCerts: []ClientCert{{SecretKey: types.NamespacedName{Namespace: "ns", Name: "client"}}},
+		},
+		{
+			name:        "other names in the secret",
+			serverCerts: []ServerCert{{CertName: "api.crt", KeyName: "api.key"}},
+		},
+		{
+			name:        "names of the server cert",
+			serverCerts: []ServerCert{{}},
+			wantErr:     true,
+		},
+		{
+			name:        "CA cert name",
+			serverCerts: []ServerCert{{SecretKey: other, CertName: caCertName}},
+			wantErr:     true,
+		},
+		{
+			name:        "same names in another secret",
+			serverCerts: []ServerCert{{SecretKey: other}},
+			clientCerts: []ClientCert{{SecretKey: other}},
+			wantErr:     true,
+		},
+		{
+			name:        "client cert in the secret",
+			clientCerts: []ClientCert{{SecretKey: key}},
+			wantErr:     true,
+		},
+		{
+			name:        "missing namespace",
+			clientCerts: []ClientCert{{SecretKey: types.NamespacedName{Name: "client"}}},
+			wantErr:     true,
+		},
+		{
+			name:        "invalid SAN",
+			serverCerts: []ServerCert{{SecretKey: other, EmailAddresses: []string{"not an email"}}},
+			wantErr:     true,
+		},
+		{
+			name:            "URI without host under name constraints",
+			serverCerts:     []ServerCert{{SecretKey: other, URIs: []*url.URL{{Scheme: "urn", Opaque: "example:api"}}}},
+			nameConstraints: true,
+			wantErr:         true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cr := &CertRotator{
+				SecretKey:         key,
+				CertName:          defaultCertName,
+				KeyName:           defaultKeyName,
+				ServerCerts:       tc.serverCerts,
+				ClientCerts:       tc.clientCerts,
+				CANameConstraints: tc.nameConstraints,
+			}
+			if err := cr.validateLeafCerts(); (err != nil) != tc.wantErr {
+				t.Errorf("got error %v, want error %v", err, tc.wantErr)
+			}
+		})
+	}
+}
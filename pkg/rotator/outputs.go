@@ -0,0 +1,151 @@
+package rotator
+
+import (
+	"bytes"
+	"encoding/pem"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// OutputFormats configures additional encodings of the server cert written to the secret of
+// the CertRotator along with it, for consumers that do not load separate PEM files. Outputs
+// whose name is empty are not written.
+type OutputFormats struct {
+	// CombinedPEMName is the key of the server cert followed by the CA cert and the private key,
+	// e.g. tls-combined.pem for HAProxy.
+	CombinedPEMName string
+	// CertDERName is the key of the DER encoded server cert, e.g. tls.der.
+	CertDERName string
+	// KeyDERName is the key of the DER encoded PKCS#1 private key, e.g. tls.key.der.
+	KeyDERName string
+	// CABundleName is the key of the PEM encoded CA certs that are currently trusted, e.g.
+	// ca-bundle.crt: the CA cert followed by the previous CA certs after rotations, until they
+	// expire, so that certs issued by any of them are trusted while the rotations roll out.
+	// Only the two most recent previous CA certs are kept.
+	CABundleName string
+}
+
+// maxCABundleCerts is the maximum number of CA certs of the CA bundle, so that it does not grow
+// with every rotation of a CA whose previous certs expire long after it is rotated.
+const maxCABundleCerts = 3
+
+// names returns the keys of the outputs that are written.
+func (o *OutputFormats) names() []string {
+	var names []string
+	for _, name := range []string{o.CombinedPEMName, o.CertDERName, o.KeyDERName, o.CABundleName} {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// populateOutputs sets the outputs of the server cert and of the CA cert in the secret. It must
+// be called before the CA cert of the secret is replaced, as it is kept in the CA bundle.
+func populateOutputs(outputs *OutputFormats, cert, key, caCert []byte, secret *corev1.Secret) {
+	if outputs.CombinedPEMName != "" {
+		secret.Data[outputs.CombinedPEMName] = combinedPEM(cert, key, caCert)
+	}
+	if outputs.CertDERName != "" {
+		secret.Data[outputs.CertDERName] = pemBlockBytes(cert)
+	}
+	if outputs.KeyDERName != "" {
+		secret.Data[outputs.KeyDERName] = pemBlockBytes(key)
+	}
+	if outputs.CABundleName != "" {
+		// The previous CA certs are the CA cert being replaced, if any, followed by the CA
+		// certs of the bundle, so that every CA cert is trusted until it expires.
+		previous := secret.Data[outputs.CABundleName]
+		if current := secret.Data[caCertName]; current != nil && !bytes.Equal(current, caCert) {
+			previous = append(append([]byte(nil), current...), previous...)
+		}
+		secret.Data[outputs.CABundleName] = caBundle(caCert, previous, time.Now())
+	}
+}
+
+// validateOutputFormats returns an error if an output is stored under the key of another
+// output or cert in the secret.
+func (cr *CertRotator) validateOutputFormats() error {
+	reserved := sets.New(caCertName, caKeyName, cr.CertName, cr.KeyName)
+	for _, leaf := range cr.leafCerts() {
+		if leaf.secretKey == cr.SecretKey {
+			reserved.Insert(leaf.certName, leaf.keyName)
+		}
+	}
+	if cr.Keystore != nil {
+		reserved.Insert(cr.Keystore.KeystoreName, cr.Keystore.TruststoreName)
+	}
+	for _, name := range cr.OutputFormats.names() {
+		if reserved.Has(name) {
+			return fmt.Errorf("output cannot be stored under %s, which holds another cert", name)
+		}
+		reserved.Insert(name)
+	}
+	return nil
+}
+
+// validOutputs returns true if the outputs of the secret match its server cert and CA cert.
+func (cr *CertRotator) validOutputs(secret *corev1.Secret) bool {
+	outputs := cr.OutputFormats
+	cert, key, caCert := secret.Data[cr.CertName], secret.Data[cr.KeyName], secret.Data[caCertName]
+	var changed string
+	switch {
+	case outputs.CombinedPEMName != "" && !bytes.Equal(secret.Data[outputs.CombinedPEMName], combinedPEM(cert, key, caCert)):
+		changed = outputs.CombinedPEMName
+	case outputs.CertDERName != "" && !bytes.Equal(secret.Data[outputs.CertDERName], pemBlockBytes(cert)):
+		changed = outputs.CertDERName
+	case outputs.KeyDERName != "" && !bytes.Equal(secret.Data[outputs.KeyDERName], pemBlockBytes(key)):
+		changed = outputs.KeyDERName
+	case outputs.CABundleName != "" && !bytes.Equal(secret.Data[outputs.CABundleName], caBundle(caCert, secret.Data[outputs.CABundleName], time.Now())):
+		changed = outputs.CABundleName
+	default:
+		return true
+	}
+	crLog.Info("output differs from the server cert", "output", changed)
+	return false
+}
+
+// combinedPEM returns the server cert followed by the CA cert and the private key.
+func combinedPEM(cert, key, caCert []byte) []byte {
+	combined := make([]byte, 0, len(cert)+len(caCert)+len(key))
+	combined = append(combined, cert...)
+	combined = append(combined, caCert...)
+	return append(combined, key...)
+}
+
+// pemBlockBytes returns the DER bytes of the first PEM block, or nil if there is none.
+func pemBlockBytes(data []byte) []byte {
+	b, _ := pem.Decode(data)
+	if b == nil {
+		return nil
+	}
+	return b.Bytes
+}
+
+// caBundle returns the CA cert followed by the previous CA certs that are neither the CA cert
+// nor expired at the given time, without duplicates, up to maxCABundleCerts certs. The previous
+// CA certs are ordered from the most recent, so the oldest ones are dropped.
+func caBundle(caCert, previous []byte, now time.Time) []byte {
+	bundle := append([]byte(nil), caCert...)
+	seen := sets.New(string(pemBlockBytes(caCert)))
+	for rest := previous; seen.Len() < maxCABundleCerts; {
+		var b *pem.Block
+		b, rest = pem.Decode(rest)
+		if b == nil {
+			break
+		}
+		if seen.Has(string(b.Bytes)) {
+			continue
+		}
+		seen.Insert(string(b.Bytes))
+		crt, err := parseCertPEM(pem.EncodeToMemory(b))
+		if err != nil || now.After(crt.NotAfter) {
+			continue
+		}
+		bundle = append(bundle, pem.EncodeToMemory(b)...)
+	}
+	return bundle
+}
@@ -0,0 +1,182 @@
+package rotator
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+func TestOutputFormats(t *testing.T) {
+	ctx := context.Background()
+	rotator, c := newTestRotator(t)
+	outputs := &OutputFormats{
+		CombinedPEMName: "tls-combined.pem",
+		CertDERName:     "tls.der",
+		KeyDERName:      "tls.key.der",
+		CABundleName:    "ca-bundle.crt",
+	}
+	rotator.OutputFormats = outputs
+	if err := rotator.validateOutputFormats(); err != nil {
+		t.Fatal(err)
+	}
+
+	secret := refreshSecret(t, rotator)
+	cert, certKey, ca := secret.Data[defaultCertName], secret.Data[defaultKeyName], secret.Data[caCertName]
+	if !bytes.Equal(secret.Data[outputs.CombinedPEMName], combinedPEM(cert, certKey, ca)) {
+		t.Error("expected the combined PEM to hold the server cert, the CA cert and the key")
+	}
+	crt, err := x509.ParseCertificate(secret.Data[outputs.CertDERName])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := x509.ParsePKCS1PrivateKey(secret.Data[outputs.KeyDERName]); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: crt.Raw}), cert) {
+		t.Error("expected the DER cert to be the server cert")
+	}
+	if !bytes.Equal(secret.Data[outputs.CABundleName], ca) {
+		t.Error("expected the CA bundle to hold the CA cert")
+	}
+
+	// The outputs are kept while they are valid.
+	if refreshed := refreshSecret(t, rotator); refreshed.ResourceVersion != secret.ResourceVersion {
+		t.Error("expected the secret not to be updated")
+	}
+
+	// The CA bundle holds the previous CA cert after a rotation.
+	delete(secret.Data, caKeyName)
+	if err := c.Update(ctx, secret); err != nil {
+		t.Fatal(err)
+	}
+	secret = refreshSecret(t, rotator)
+	rotatedCA := secret.Data[caCertName]
+	if bytes.Equal(rotatedCA, ca) {
+		t.Fatal("expected the CA to be rotated")
+	}
+	want := append(append([]byte(nil), rotatedCA...), ca...)
+	if !bytes.Equal(secret.Data[outputs.CABundleName], want) {
+		t.Error("expected the CA bundle to hold the rotated and the previous CA certs")
+	}
+	if !bytes.Equal(secret.Data[outputs.CombinedPEMName], combinedPEM(secret.Data[defaultCertName], secret.Data[defaultKeyName], rotatedCA)) {
+		t.Error("expected the combined PEM to be updated")
+	}
+
+	// The outputs are rewritten with the previous CA cert without re-issuing the server cert.
+	serverCert := secret.Data[defaultCertName]
+	delete(secret.Data, outputs.CertDERName)
+	if err := c.Update(ctx, secret); err != nil {
+		t.Fatal(err)
+	}
+	secret = refreshSecret(t, rotator)
+	if secret.Data[outputs.CertDERName] == nil || !bytes.Equal(secret.Data[outputs.CABundleName], want) {
+		t.Error("expected the outputs to be rewritten with the previous CA cert")
+	}
+	if !bytes.Equal(secret.Data[defaultCertName], serverCert) {
+		t.Error("expected the server cert not to be re-issued")
+	}
+
+	// The CA bundle holds every previous CA cert after another rotation.
+	delete(secret.Data, caKeyName)
+	if err := c.Update(ctx, secret); err != nil {
+		t.Fatal(err)
+	}
+	secret = refreshSecret(t, rotator)
+	want = append(append([]byte(nil), secret.Data[caCertName]...), want...)
+	if !bytes.Equal(secret.Data[outputs.CABundleName], want) {
+		t.Error("expected the CA bundle to hold the rotated and both previous CA certs")
+	}
+	// The CA certs of the bundle share their subject, and are told apart by their serial numbers.
+	serials := sets.New[string]()
+	for rest := want; ; {
+		var b *pem.Block
+		if b, rest = pem.Decode(rest); b == nil {
+			break
+		}
+		crt, err := x509.ParseCertificate(b.Bytes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		serials.Insert(crt.SerialNumber.String())
+	}
+	if serials.Len() != 3 {
+		t.Errorf("expected the CA certs of the bundle to have unique serial numbers, got %v", sets.List(serials))
+	}
+
+	// Expired CA certs are dropped from the CA bundle without re-issuing the server cert.
+	expired, err := rotator.CreateCACert(time.Now().Add(-2*time.Hour), time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverCert = secret.Data[defaultCertName]
+	secret.Data[outputs.CABundleName] = append(append([]byte(nil), want...), expired.CertPEM...)
+	if err := c.Update(ctx, secret); err != nil {
+		t.Fatal(err)
+	}
+	secret = refreshSecret(t, rotator)
+	if !bytes.Equal(secret.Data[outputs.CABundleName], want) {
+		t.Error("expected the expired CA cert to be dropped")
+	}
+	if !bytes.Equal(secret.Data[defaultCertName], serverCert) {
+		t.Error("expected the server cert not to be re-issued")
+	}
+	if got := caBundle(ca, want, time.Now().Add(2*defaultCaCertValidityDuration)); !bytes.Equal(got, ca) {
+		t.Error("expected the expired previous CA certs to be dropped")
+	}
+}
+
+// Verifies that the CA bundle does not grow with every rotation of the CA.
+func TestCABundleRotations(t *testing.T) {
+	ctx := context.Background()
+	rotator, c := newTestRotator(t)
+	outputs := &OutputFormats{CABundleName: "ca-bundle.crt"}
+	rotator.OutputFormats = outputs
+
+	secret := refreshSecret(t, rotator)
+	var cas [][]byte
+	for i := 0; i < 2*maxCABundleCerts; i++ {
+		cas = append([][]byte{secret.Data[caCertName]}, cas...)
+		delete(secret.Data, caKeyName)
+		if err := c.Update(ctx, secret); err != nil {
+			t.Fatal(err)
+		}
+		secret = refreshSecret(t, rotator)
+		if bytes.Equal(secret.Data[caCertName], cas[0]) {
+			t.Fatal("expected the CA to be rotated")
+		}
+	}
+	// The bundle holds the CA cert and the most recent previous CA certs.
+	want := append([]byte(nil), secret.Data[caCertName]...)
+	for _, ca := range cas[:maxCABundleCerts-1] {
+		want = append(want, ca...)
+	}
+	if !bytes.Equal(secret.Data[outputs.CABundleName], want) {
+		t.Errorf("expected the CA bundle to hold the %d most recent CA certs", maxCABundleCerts)
+	}
+	// The outputs are kept while they are valid.
+	if refreshed := refreshSecret(t, rotator); refreshed.ResourceVersion != secret.ResourceVersion {
+		t.Error("expected the secret not to be updated")
+	}
+}
+
+func TestValidateOutputFormats(t *testing.T) {
+	cr := &CertRotator{
+		SecretKey:     types.NamespacedName{Namespace: "ns", Name: "secret"},
+		CertName:      defaultCertName,
+		KeyName:       defaultKeyName,
+		OutputFormats: &OutputFormats{CertDERName: "tls.der", KeyDERName: "tls.der"},
+	}
+	if err := cr.validateOutputFormats(); err == nil {
+		t.Error("expected an error for outputs with the same name")
+	}
+	cr.OutputFormats = &OutputFormats{CABundleName: caCertName}
+	if err := cr.validateOutputFormats(); err == nil {
+		t.Error("expected an error for an output under the CA cert")
+	}
+}
@@ -0,0 +1,212 @@
+package rotator
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+)
+
+// Permissions are the RBAC rules required by a CertRotator, restricted to the objects it manages.
+type Permissions struct {
+	// ClusterRules are the rules for cluster-scoped resources, to be granted by a ClusterRole.
+	ClusterRules []rbacv1.PolicyRule
+	// NamespaceRules are the rules for namespaced resources by namespace, to be granted
+	// by a Role in that namespace.
+	NamespaceRules map[string][]rbacv1.PolicyRule
+}
+
+// Permissions returns the RBAC rules required by the CertRotator: get and update on its secrets
+// and webhooks, and list and watch on them for its caches, except for the secret of the CA,
+// which is not cached, and get on the secret of the keystore password, which is only read. As
+// every object is cached on its own with a `metadata.name` field selector, list and watch are
+// restricted to the named objects too. When Reader is a cache.Cache, such as the cache of the
+// manager, it lists and watches every object of their kinds instead, so list and watch are
+// not restricted to the named objects in the cluster of the manager.
+// The mapper is used to resolve the resources of Generic webhooks, and may be nil otherwise.
+// Webhooks of target clusters are not included, see TargetClusterPermissions.
+func (cr *CertRotator) Permissions(mapper meta.RESTMapper) (*Permissions, error) {
+	return cr.permissions("", mapper)
+}
+
+// TargetClusterPermissions returns the RBAC rules required by the CertRotator in the named
+// target cluster to inject its webhooks, as for Permissions.
+func (cr *CertRotator) TargetClusterPermissions(cluster string, mapper meta.RESTMapper) (*Permissions, error) {
+	if cr.TargetClusters[cluster] == nil {
+		return nil, fmt.Errorf("unknown target cluster %s", cluster)
+	}
+	return cr.permissions(cluster, mapper)
+}
+
+// permissions returns the RBAC rules required in the named cluster, or in the cluster of
+// the manager if the name is empty.
+func (cr *CertRotator) permissions(cluster string, mapper meta.RESTMapper) (*Permissions, error) {
+	if cr.SecretKey.Namespace == "" {
+		return nil, fmt.Errorf("invalid namespace for secret")
+	}
+	type scope struct {
+		resource  schema.GroupResource
+		namespace string
+	}
+	names := make(map[scope]sets.Set[string])
+	if cluster == "" {
+		secrets := schema.GroupResource{Resource: "secrets"}
+		names[scope{resource: secrets, namespace: cr.SecretKey.Namespace}] = sets.New(cr.SecretKey.Name)
+		for _, key := range cr.otherSecretKeys() {
+			s := scope{resource: secrets, namespace: key.Namespace}
+			if names[s] == nil {
+				names[s] = sets.New[string]()
+			}
+			names[s].Insert(key.Name)
+		}
+	}
+	for _, webhook := range cr.Webhooks {
+		if webhook.Cluster != cluster {
+			continue
+		}
+		target, err := webhook.target()
+		if err != nil {
+			return nil, err
+		}
+		resource := schema.GroupResource{Group: target.gvk.Group, Resource: target.resource}
+		if webhook.Type == Generic {
+			if mapper == nil {
+				return nil, fmt.Errorf("webhook %s: a RESTMapper is required to resolve the resource of Generic webhooks", webhook.Name)
+			}
+			var versions []string
+			if target.gvk.Version != "" {
+				versions = append(versions, target.gvk.Version)
+			}
+			mapping, err := mapper.RESTMapping(target.gvk.GroupKind(), versions...)
+			if err != nil {
+				return nil, fmt.Errorf("webhook %s: %w", webhook.Name, err)
+			}
+			resource = mapping.Resource.GroupResource()
+		}
+		s := scope{resource: resource, namespace: webhook.key(cr.SecretKey.Namespace).Namespace}
+		if names[s] == nil {
+			names[s] = sets.New[string]()
+		}
+		names[s].Insert(webhook.Name)
+	}
+
+	// A shared cache is not restricted to the objects of the rotator.
+	_, shared := cr.Reader.(cache.Cache)
+	shared = shared && cluster == ""
+	p := &Permissions{NamespaceRules: make(map[string][]rbacv1.PolicyRule)}
+	for s, objNames := range names {
+		rules := policyRules(s.resource, sets.List(objNames), shared)
+		if s.namespace == "" {
+			p.ClusterRules = append(p.ClusterRules, rules...)
+		} else {
+			p.NamespaceRules[s.namespace] = append(p.NamespaceRules[s.namespace], rules...)
+		}
+	}
+	// The secret of the CA is not cached, and is only read and updated.
+	if cluster == "" && cr.separateCASecret() {
+		ns := cr.CASecretKey.Namespace
+		p.NamespaceRules[ns] = append(p.NamespaceRules[ns], rbacv1.PolicyRule{
+			APIGroups:     []string{""},
+			Resources:     []string{"secrets"},
+			ResourceNames: []string{cr.CASecretKey.Name},
+			Verbs:         []string{"get", "update"},
+		})
+	}
+	// The secret of the keystore password is not cached, and is only read.
+	if cluster == "" && cr.Keystore != nil {
+		key := cr.Keystore.PasswordSecretKey
+		cached := names[scope{resource: schema.GroupResource{Resource: "secrets"}, namespace: key.Namespace}]
+		if !cached.Has(key.Name) && (!cr.separateCASecret() || key != cr.CASecretKey) {
+			p.NamespaceRules[key.Namespace] = append(p.NamespaceRules[key.Namespace], rbacv1.PolicyRule{
+				APIGroups:     []string{""},
+				Resources:     []string{"secrets"},
+				ResourceNames: []string{key.Name},
+				Verbs:         []string{"get"},
+			})
+		}
+	}
+	sortPolicyRules(p.ClusterRules)
+	for _, rules := range p.NamespaceRules {
+		sortPolicyRules(rules)
+	}
+	return p, nil
+}
+
+// KubebuilderMarkers returns the permissions as `+kubebuilder:rbac` markers, to be
+// copied into the source of a kubebuilder project.
+func (p *Permissions) KubebuilderMarkers() []string {
+	var markers []string
+	for _, rule := range p.ClusterRules {
+		markers = append(markers, kubebuilderMarker(rule, ""))
+	}
+	namespaces := make([]string, 0, len(p.NamespaceRules))
+	for ns := range p.NamespaceRules {
+		namespaces = append(namespaces, ns)
+	}
+	sort.Strings(namespaces)
+	for _, ns := range namespaces {
+		for _, rule := range p.NamespaceRules[ns] {
+			markers = append(markers, kubebuilderMarker(rule, ns))
+		}
+	}
+	return markers
+}
+
+// policyRules returns the rules to get, update, list and watch the named objects of a resource,
+// or to list and watch all its objects if they are cached by a shared cache.
+func policyRules(resource schema.GroupResource, names []string, shared bool) []rbacv1.PolicyRule {
+	if !shared {
+		return []rbacv1.PolicyRule{{
+			APIGroups:     []string{resource.Group},
+			Resources:     []string{resource.Resource},
+			ResourceNames: names,
+			Verbs:         []string{"get", "list", "update", "watch"},
+		}}
+	}
+	return []rbacv1.PolicyRule{{
+		APIGroups:     []string{resource.Group},
+		Resources:     []string{resource.Resource},
+		ResourceNames: names,
+		Verbs:         []string{"get", "update"},
+	}, {
+		APIGroups: []string{resource.Group},
+		Resources: []string{resource.Resource},
+		Verbs:     []string{"list", "watch"},
+	}}
+}
+
+func sortPolicyRules(rules []rbacv1.PolicyRule) {
+	sort.SliceStable(rules, func(i, j int) bool {
+		if rules[i].APIGroups[0] != rules[j].APIGroups[0] {
+			return rules[i].APIGroups[0] < rules[j].APIGroups[0]
+		}
+		if rules[i].Resources[0] != rules[j].Resources[0] {
+			return rules[i].Resources[0] < rules[j].Resources[0]
+		}
+		if len(rules[i].Verbs) != len(rules[j].Verbs) {
+			return len(rules[i].Verbs) > len(rules[j].Verbs)
+		}
+		return strings.Join(rules[i].Verbs, ";") < strings.Join(rules[j].Verbs, ";")
+	})
+}
+
+func kubebuilderMarker(rule rbacv1.PolicyRule, namespace string) string {
+	group := rule.APIGroups[0]
+	if group == "" {
+		group = "core"
+	}
+	marker := fmt.Sprintf("// +kubebuilder:rbac:groups=%s,resources=%s,verbs=%s",
+		group, strings.Join(rule.Resources, ";"), strings.Join(rule.Verbs, ";"))
+	if len(rule.ResourceNames) > 0 {
+		marker += ",resourceNames=" + strings.Join(rule.ResourceNames, ";")
+	}
+	if namespace != "" {
+		marker += ",namespace=" + namespace
+	}
+	return marker
+}
@@ -0,0 +1,172 @@
+package rotator
+
+import (
+	"reflect"
+	"testing"
+
+	admissionv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/cache/informertest"
+)
+
+func TestPermissions(t *testing.T) {
+	gvk := schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Provider"}
+	mapper := meta.NewDefaultRESTMapper([]schema.GroupVersion{gvk.GroupVersion()})
+	mapper.Add(gvk, meta.RESTScopeNamespace)
+
+	cr := &CertRotator{
+		SecretKey: types.NamespacedName{Namespace: "ns", Name: "secret"},
+		Webhooks: []WebhookInfo{
+			{Name: "vwh", Type: Validating},
+			{Name: "vwh2", Type: Validating},
+			{Name: "mwh", Type: Mutating},
+			{Name: "ca", Type: ConfigMap},
+			{Name: "provider", Namespace: "other", Type: Generic, GVK: gvk, FieldPaths: []string{"spec.caBundle"}},
+			{Name: "guest-apiservice", Type: APIService, Cluster: "guest"},
+		},
+		TargetClusters: map[string]*rest.Config{"guest": {}},
+	}
+
+	if _, err := cr.Permissions(nil); err == nil {
+		t.Error("expected error resolving a Generic webhook without a RESTMapper")
+	}
+
+	p, err := cr.Permissions(mapper)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantCluster := []rbacv1.PolicyRule{
+		{APIGroups: []string{"admissionregistration.k8s.io"}, Resources: []string{"mutatingwebhookconfigurations"}, ResourceNames: []string{"mwh"}, Verbs: []string{"get", "list", "update", "watch"}},
+		{APIGroups: []string{"admissionregistration.k8s.io"}, Resources: []string{"validatingwebhookconfigurations"}, ResourceNames: []string{"vwh", "vwh2"}, Verbs: []string{"get", "list", "update", "watch"}},
+	}
+	if !reflect.DeepEqual(p.ClusterRules, wantCluster) {
+		t.Errorf("cluster rules: got %v, want %v", p.ClusterRules, wantCluster)
+	}
+	wantNamespace := map[string][]rbacv1.PolicyRule{
+		"ns": {
+			{APIGroups: []string{""}, Resources: []string{"configmaps"}, ResourceNames: []string{"ca"}, Verbs: []string{"get", "list", "update", "watch"}},
+			{APIGroups: []string{""}, Resources: []string{"secrets"}, ResourceNames: []string{"secret"}, Verbs: []string{"get", "list", "update", "watch"}},
+		},
+		"other": {
+			{APIGroups: []string{"example.com"}, Resources: []string{"providers"}, ResourceNames: []string{"provider"}, Verbs: []string{"get", "list", "update", "watch"}},
+		},
+	}
+	if !reflect.DeepEqual(p.NamespaceRules, wantNamespace) {
+		t.Errorf("namespace rules: got %v, want %v", p.NamespaceRules, wantNamespace)
+	}
+
+	wantMarkers := []string{
+		"// +kubebuilder:rbac:groups=admissionregistration.k8s.io,resources=mutatingwebhookconfigurations,verbs=get;list;update;watch,resourceNames=mwh",
+		"// +kubebuilder:rbac:groups=admissionregistration.k8s.io,resources=validatingwebhookconfigurations,verbs=get;list;update;watch,resourceNames=vwh;vwh2",
+		"// +kubebuilder:rbac:groups=core,resources=configmaps,verbs=get;list;update;watch,resourceNames=ca,namespace=ns",
+		"// +kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;update;watch,resourceNames=secret,namespace=ns",
+		"// +kubebuilder:rbac:groups=example.com,resources=providers,verbs=get;list;update;watch,resourceNames=provider,namespace=other",
+	}
+	if got := p.KubebuilderMarkers(); !reflect.DeepEqual(got, wantMarkers) {
+		t.Errorf("markers: got %v, want %v", got, wantMarkers)
+	}
+
+	if _, err := cr.TargetClusterPermissions("unknown", mapper); err == nil {
+		t.Error("expected error for an unknown target cluster")
+	}
+	guest, err := cr.TargetClusterPermissions("guest", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantGuest := []rbacv1.PolicyRule{
+		{APIGroups: []string{"apiregistration.k8s.io"}, Resources: []string{"apiservices"}, ResourceNames: []string{"guest-apiservice"}, Verbs: []string{"get", "list", "update", "watch"}},
+	}
+	if !reflect.DeepEqual(guest.ClusterRules, wantGuest) || len(guest.NamespaceRules) != 0 {
+		t.Errorf("guest rules: got %v, want %v", guest, wantGuest)
+	}
+}
+
+// Verifies that every object cached by the rotator can be listed and watched by name,
+// including webhooks sharing their kind.
+func TestPermissionsMatchCache(t *testing.T) {
+	mapper := meta.NewDefaultRESTMapper([]schema.GroupVersion{corev1.SchemeGroupVersion, admissionv1.SchemeGroupVersion})
+	mapper.Add(corev1.SchemeGroupVersion.WithKind("Secret"), meta.RESTScopeNamespace)
+	mapper.Add(admissionv1.SchemeGroupVersion.WithKind("ValidatingWebhookConfiguration"), meta.RESTScopeRoot)
+
+	cr := &CertRotator{
+		SecretKey:   types.NamespacedName{Namespace: "ns", Name: "secret"},
+		CASecretKey: types.NamespacedName{Namespace: "ns", Name: "ca"},
+		Webhooks: []WebhookInfo{
+			{Name: "vwh", Type: Validating},
+			{Name: "vwh2", Type: Validating},
+		},
+		Keystore: &Keystore{PasswordSecretKey: types.NamespacedName{Namespace: "ns", Name: "password"}},
+	}
+	p, err := cr.Permissions(mapper)
+	if err != nil {
+		t.Fatal(err)
+	}
+	objs, err := cachedObjects(cr, "", cr.SecretKey.Namespace, mapper)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objs) != 3 {
+		t.Fatalf("expected the secret and both webhooks to be cached, got %d objects", len(objs))
+	}
+	// The secret of the CA is not cached, and cannot be listed or watched.
+	if rules := p.NamespaceRules["ns"]; allowsNamed(rules, "ca", "list") || !allowsNamed(rules, "ca", "get", "update") {
+		t.Errorf("expected the CA secret to be only read and updated, got %v", rules)
+	}
+	// Neither is the secret of the keystore password, which is only read.
+	if rules := p.NamespaceRules["ns"]; allowsNamed(rules, "password", "update") || !allowsNamed(rules, "password", "get") {
+		t.Errorf("expected the password secret to be only read, got %v", rules)
+	}
+	for _, obj := range objs {
+		rules := p.ClusterRules
+		if obj.key.Namespace != "" {
+			rules = p.NamespaceRules[obj.key.Namespace]
+		}
+		if !allowsNamed(rules, obj.key.Name, "list", "watch") {
+			t.Errorf("expected %s to be listed and watched by name, got %v", obj.key, rules)
+		}
+	}
+}
+
+// Verifies that list and watch are not restricted by name when Reader is a shared cache,
+// which lists and watches every object of a kind.
+func TestPermissionsSharedCache(t *testing.T) {
+	cr := &CertRotator{
+		SecretKey: types.NamespacedName{Namespace: "ns", Name: "secret"},
+		Webhooks:  []WebhookInfo{{Name: "vwh", Type: Validating}},
+		Reader:    &informertest.FakeInformers{},
+	}
+	p, err := cr.Permissions(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantCluster := []rbacv1.PolicyRule{
+		{APIGroups: []string{"admissionregistration.k8s.io"}, Resources: []string{"validatingwebhookconfigurations"}, ResourceNames: []string{"vwh"}, Verbs: []string{"get", "update"}},
+		{APIGroups: []string{"admissionregistration.k8s.io"}, Resources: []string{"validatingwebhookconfigurations"}, Verbs: []string{"list", "watch"}},
+	}
+	if !reflect.DeepEqual(p.ClusterRules, wantCluster) {
+		t.Errorf("cluster rules: got %v, want %v", p.ClusterRules, wantCluster)
+	}
+	wantNamespace := []rbacv1.PolicyRule{
+		{APIGroups: []string{""}, Resources: []string{"secrets"}, ResourceNames: []string{"secret"}, Verbs: []string{"get", "update"}},
+		{APIGroups: []string{""}, Resources: []string{"secrets"}, Verbs: []string{"list", "watch"}},
+	}
+	if !reflect.DeepEqual(p.NamespaceRules["ns"], wantNamespace) {
+		t.Errorf("namespace rules: got %v, want %v", p.NamespaceRules["ns"], wantNamespace)
+	}
+}
+
+// allowsNamed returns true if a rule restricted to the name allows the verbs.
+func allowsNamed(rules []rbacv1.PolicyRule, name string, verbs ...string) bool {
+	for _, rule := range rules {
+		if sets.New(rule.ResourceNames...).Has(name) && sets.New(rule.Verbs...).HasAll(verbs...) {
+			return true
+		}
+	}
+	return false
+}
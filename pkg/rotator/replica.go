@@ -0,0 +1,146 @@
+package rotator
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// replicaCheckInterval is how often a replica checks whether its mounted certs match the
+// secret before it is ready.
+const replicaCheckInterval = 5 * time.Second
+
+// replicaRotator runs on every replica when CertRotator.RequireLeaderElection is true, while
+// only the leader runs the CertRotator itself. It verifies that the certs mounted on the replica
+// match the secret written by the leader, and closes IsReady once they do on replicas that are
+// not the leader. The leader closes IsReady once the webhooks are injected, as usual.
+type replicaRotator struct {
+	cr *CertRotator
+}
+
+func (r *replicaRotator) NeedLeaderElection() bool {
+	return false
+}
+
+func (r *replicaRotator) Start(ctx context.Context) error {
+	cr := r.cr
+	if !cr.reader.WaitForCacheSync(ctx) {
+		return errors.New("failed waiting for reader to sync")
+	}
+
+	go cr.ensureCertsMounted()
+	select {
+	case <-cr.certsMounted:
+	case <-cr.certsNotMounted:
+		return errors.New("could not mount certs")
+	case <-ctx.Done():
+		return nil
+	}
+
+	err := wait.PollUntilContextCancel(ctx, replicaCheckInterval, true, func(ctx context.Context) (bool, error) {
+		if cr.leading() {
+			return true, nil
+		}
+		if err := cr.checkMountedCerts(ctx); err != nil {
+			crLog.Info("waiting for mounted certs to match the secret", "reason", err.Error())
+			return false, nil
+		}
+		crLog.Info("mounted certs match the secret")
+		cr.markReady()
+		return true, nil
+	})
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		return err
+	}
+
+	ticker := time.NewTicker(cr.RotationCheckFrequency)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := cr.checkMountedCerts(ctx); err != nil {
+				crLog.Error(err, "mounted certs do not match the secret")
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// CheckCerts returns an error if the certs mounted on the replica are not the valid certs
+// stored in the secret, e.g. because the secret volume was not updated yet after a rotation.
+// It can be used as a readiness check on every replica:
+//
+//	mgr.AddReadyzCheck("certs", cr.CheckCerts)
+func (cr *CertRotator) CheckCerts(req *http.Request) error {
+	if cr.reader == nil {
+		return errors.New("cert rotator is not added to a manager")
+	}
+	ctx := context.Background()
+	if req != nil {
+		ctx = req.Context()
+	}
+	return cr.checkMountedCerts(ctx)
+}
+
+// checkMountedCerts checks that the mounted server certs are the valid server certs of their secrets.
+func (cr *CertRotator) checkMountedCerts(ctx context.Context) error {
+	secret := &corev1.Secret{}
+	if err := cr.reader.Get(ctx, cr.SecretKey, secret); err != nil {
+		return errors.Wrap(err, "acquiring secret to verify mounted certificates")
+	}
+	if !validMountedCert(secret.Data[caCertName], secret.Data[cr.CertName], secret.Data[cr.KeyName], cr.ExtKeyUsages) {
+		return errors.New("secret does not hold a valid server certificate")
+	}
+	if err := checkMountedCert(cr.CertDir, cr.CertName, secret); err != nil {
+		return err
+	}
+
+	for _, serverCert := range cr.ServerCerts {
+		leaf := cr.serverLeafCert(serverCert)
+		if leaf.certDir == "" {
+			continue
+		}
+		secret := &corev1.Secret{}
+		if err := cr.reader.Get(ctx, leaf.secretKey, secret); err != nil {
+			return errors.Wrapf(err, "acquiring secret %s to verify mounted certificates", leaf.secretKey)
+		}
+		if !validMountedCert(secret.Data[caCertName], secret.Data[leaf.certName], secret.Data[leaf.keyName], &leaf.spec.extKeyUsages) {
+			return errors.Errorf("secret %s does not hold a valid server certificate under %s", leaf.secretKey, leaf.certName)
+		}
+		if err := checkMountedCert(leaf.certDir, leaf.certName, secret); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validMountedCert returns true if the cert is issued by the CA cert and has not expired. Unlike
+// validServerCert, it does not compare the cert with its desired spec, which depends on the
+// Services only discovered by the leader, nor anticipate its rotation by the lookahead interval.
+func validMountedCert(caCert, cert, key []byte, keyUsages *[]x509.ExtKeyUsage) bool {
+	valid, err := ValidCert(caCert, cert, key, "", keyUsages, time.Now())
+	return err == nil && valid
+}
+
+// checkMountedCert checks that the cert mounted in the directory is the cert of the secret.
+func checkMountedCert(certDir, certName string, secret *corev1.Secret) error {
+	mounted, err := os.ReadFile(certDir + "/" + certName)
+	if err != nil {
+		return errors.Wrap(err, "reading mounted certificate")
+	}
+	if !bytes.Equal(mounted, secret.Data[certName]) {
+		return errors.Errorf("mounted certificate %s does not match the secret", certDir+"/"+certName)
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package rotator
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	admissionv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/cache/informertest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// syncedReader is a SyncingReader that is always synced.
+type syncedReader struct {
+	client.Reader
+}
+
+func (syncedReader) WaitForCacheSync(_ context.Context) bool {
+	return true
+}
+
+func TestReplicaRotator(t *testing.T) {
+	key := types.NamespacedName{Namespace: "ns", Name: "secret"}
+	elected := make(chan struct{})
+	rotator := &CertRotator{
+		SecretKey:              key,
+		CertDir:                t.TempDir(),
+		CertName:               defaultCertName,
+		KeyName:                defaultKeyName,
+		CAName:                 "ca",
+		CAOrganization:         "org",
+		DNSName:                "service.namespace",
+		ExtKeyUsages:           cr.ExtKeyUsages,
+		RotationCheckFrequency: time.Hour,
+		IsReady:                make(chan struct{}),
+		certsMounted:           make(chan struct{}),
+		certsNotMounted:        make(chan struct{}),
+		RequireLeaderElection:  true,
+		elected:                elected,
+		webhookStatuses:        newWebhookStatuses([]WebhookInfo{{Name: "vwh"}}),
+	}
+
+	caArtifacts, err := rotator.CreateCACert(begin, end)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The leader issues the server cert for the Services of the webhooks, which replicas do
+	// not discover, so that they only verify the mounted cert against the CA of the secret.
+	rotator.Services = []types.NamespacedName{{Namespace: "ns", Name: "webhook-service"}}
+	cert, certKey, err := rotator.CreateCertPEM(caArtifacts, begin, end)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotator.Services = nil
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: key.Namespace, Name: key.Name}}
+	populateSecret(cert, certKey, rotator.CertName, rotator.KeyName, caArtifacts, nil, secret)
+	rotator.reader = syncedReader{fake.NewClientBuilder().WithObjects(secret).Build()}
+
+	if err := rotator.CheckCerts(nil); err == nil {
+		t.Error("expected error for missing mounted cert")
+	}
+	certFile := filepath.Join(rotator.CertDir, rotator.CertName)
+	if err := os.WriteFile(certFile, []byte("stale"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := rotator.CheckCerts(nil); err == nil {
+		t.Error("expected error for a mounted cert that does not match the secret")
+	}
+	// Replicas that are not the leader check their mounted certs instead of the webhooks.
+	if err := rotator.CheckWebhooks(nil); err == nil {
+		t.Error("expected error for a mounted cert that does not match the secret")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error)
+	go func() {
+		done <- (&replicaRotator{cr: rotator}).Start(ctx)
+	}()
+
+	if err := os.WriteFile(certFile, cert, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-rotator.IsReady:
+	case <-time.After(30 * time.Second):
+		t.Fatal("timed out waiting for the replica to be ready")
+	}
+	if err := rotator.CheckCerts(nil); err != nil {
+		t.Errorf("unexpected error for a mounted cert matching the secret: %v", err)
+	}
+	if err := rotator.CheckWebhooks(nil); err != nil {
+		t.Errorf("unexpected error for a replica that is not the leader: %v", err)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("unexpected error stopping the replica: %v", err)
+	}
+
+	// The leader checks the webhooks it injects.
+	close(elected)
+	if err := rotator.CheckWebhooks(nil); err == nil {
+		t.Error("expected error for a webhook the leader did not inject")
+	}
+}
+
+// Verifies that replicas that are not the leader only wait for the caches of the secrets,
+// as the caches of the webhooks are only started by the leader.
+func TestObjectCachesLeaderElection(t *testing.T) {
+	synced, notSynced := true, false
+	secretKey := objectKey{gvk: corev1.SchemeGroupVersion.WithKind("Secret"), key: types.NamespacedName{Namespace: "ns", Name: "secret"}}
+	webhookKey := objectKey{gvk: admissionv1.SchemeGroupVersion.WithKind("ValidatingWebhookConfiguration"), key: types.NamespacedName{Name: "vwh"}}
+	leading := false
+	c := &objectCaches{
+		leaderElection: true,
+		leading:        func() bool { return leading },
+		caches: map[objectKey]cache.Cache{
+			secretKey:  &informertest.FakeInformers{Synced: &synced},
+			webhookKey: &informertest.FakeInformers{Synced: &notSynced},
+		},
+	}
+	if c.needLeaderElection(secretKey) || !c.needLeaderElection(webhookKey) {
+		t.Error("expected only the cache of the webhook to need leader election")
+	}
+	if !c.WaitForCacheSync(context.Background()) {
+		t.Error("expected a replica that is not the leader not to wait for the cache of the webhook")
+	}
+	leading = true
+	if c.WaitForCacheSync(context.Background()) {
+		t.Error("expected the leader to wait for the cache of the webhook")
+	}
+	c.leaderElection = false
+	if c.needLeaderElection(webhookKey) {
+		t.Error("expected no cache to need leader election without RequireLeaderElection")
+	}
+}
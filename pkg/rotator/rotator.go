@@ -8,24 +8,31 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"crypto/x509/pkix"
-	"encoding/base64"
 	"encoding/pem"
 	"fmt"
-	"math/big"
+	"net"
+	"net/http"
+	"net/url"
 	"os"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/pkg/errors"
-	"go.uber.org/atomic"
 	corev1 "k8s.io/api/core/v1"
 	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/rest"
 	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
@@ -44,11 +51,13 @@ const (
 	defaultCaCertValidityDuration     = 10 * 365 * 24 * time.Hour
 	defaultServerCertValidityDuration = 1 * 365 * 24 * time.Hour
 	defaultLookaheadInterval          = 90 * 24 * time.Hour
+	unservedWebhookRetryInterval      = 1 * time.Minute
 )
 
 var crLog = logf.Log.WithName("cert-rotation")
 
-// WebhookType it the type of webhook, either validating/mutating webhook, a CRD conversion webhook, or an extension API server.
+// WebhookType it the type of webhook, either validating/mutating webhook, a CRD conversion webhook, an extension API server,
+// or any other resource carrying a CA bundle.
 type WebhookType int
 
 const (
@@ -62,6 +71,12 @@ const (
 	APIService
 	// ExternalDataProvider indicates the webhook is a Gatekeeper External Data Provider.
 	ExternalDataProvider
+	// ConfigMap indicates the CA cert is published as PEM under the `ca.crt` key of a ConfigMap
+	// in the namespace of the secret, e.g. one referenced by a Gateway API BackendTLSPolicy.
+	ConfigMap
+	// Generic indicates the CA bundle is injected into the fields at WebhookInfo.FieldPaths
+	// of a resource of kind WebhookInfo.GVK.
+	Generic
 )
 
 var (
@@ -95,18 +110,29 @@ func (cw *cacheWrapper) NeedLeaderElection() bool {
 type WebhookInfo struct {
 	// Name is the name of the webhook for a validating or mutating webhook, or the CRD name in case of a CRD conversion webhook
 	Name string
-	Type WebhookType
-}
-
-func (w WebhookInfo) gvk() schema.GroupVersionKind {
-	t2g := map[WebhookType]schema.GroupVersionKind{
-		Validating:           {Group: "admissionregistration.k8s.io", Version: "v1", Kind: "ValidatingWebhookConfiguration"},
-		Mutating:             {Group: "admissionregistration.k8s.io", Version: "v1", Kind: "MutatingWebhookConfiguration"},
-		CRDConversion:        {Group: "apiextensions.k8s.io", Version: "v1", Kind: "CustomResourceDefinition"},
-		APIService:           {Group: "apiregistration.k8s.io", Version: "v1", Kind: "APIService"},
-		ExternalDataProvider: {Group: "externaldata.gatekeeper.sh", Version: "v1beta1", Kind: "Provider"},
-	}
-	return t2g[w.Type]
+	// Namespace is the namespace of a namespaced resource. It defaults to the namespace
+	// of the secret for ConfigMap webhooks, and must be empty for cluster-scoped resources.
+	Namespace string
+	Type      WebhookType
+	// Optional webhooks are not required to carry the current CA cert for the rotator
+	// to be ready when RequireAllWebhooksInjected is set.
+	Optional bool
+	// Version pins the API version used to access the resource, e.g. v1beta1.
+	// By default, the version preferred by the API server is used.
+	Version string
+	// GVK is the kind of the resource for a Generic webhook. If its version is empty,
+	// the version preferred by the API server is used.
+	GVK schema.GroupVersionKind
+	// FieldPaths are the paths to the CA bundle fields for a Generic webhook, e.g. `spec.caBundle`.
+	// Every item of a list is updated with `[*]`, as in `webhooks[*].clientConfig.caBundle`,
+	// and dots within a field name are escaped with a backslash, as in `data.ca\.crt`.
+	FieldPaths []string
+	// Encoding is the encoding of the CA bundle written to FieldPaths for a Generic webhook.
+	// Defaults to Base64Encoding.
+	Encoding CABundleEncoding
+	// Cluster is the name of the cluster of the resource in CertRotator.TargetClusters.
+	// Defaults to the cluster of the manager.
+	Cluster string
 }
 
 // AddRotator adds the CertRotator and ReconcileWH to the manager.
@@ -118,33 +144,94 @@ func AddRotator(mgr manager.Manager, cr *CertRotator) error {
 	if ns == "" {
 		return fmt.Errorf("invalid namespace for secret")
 	}
-	cache, err := addNamespacedCache(mgr, cr, ns)
-	if err != nil {
-		return fmt.Errorf("creating namespaced cache: %w", err)
+	// The names of the server cert are defaulted first, as the leaf certs default to them.
+	if cr.CertName == "" {
+		cr.CertName = defaultCertName
+	}
+	if cr.KeyName == "" {
+		cr.KeyName = defaultKeyName
+	}
+	if err := cr.validateSANs(); err != nil {
+		return err
+	}
+	if cr.CASecretKey.Name != "" && cr.CASecretKey.Namespace == "" {
+		cr.CASecretKey.Namespace = ns
+	}
+	if cr.CASecretKey != (types.NamespacedName{}) && (cr.CASecretKey.Name == "" || cr.CASecretKey == cr.SecretKey) {
+		return fmt.Errorf("invalid CA secret %s", cr.CASecretKey)
+	}
+	if err := cr.validateLeafCerts(); err != nil {
+		return err
+	}
+	if cr.Keystore != nil {
+		if err := cr.validateKeystore(); err != nil {
+			return err
+		}
+	}
+	if cr.OutputFormats != nil {
+		if err := cr.validateOutputFormats(); err != nil {
+			return err
+		}
+	}
+	for _, webhook := range cr.Webhooks {
+		if _, err := webhook.target(); err != nil {
+			return fmt.Errorf("invalid webhook: %w", err)
+		}
+		if webhook.Cluster != "" && cr.TargetClusters[webhook.Cluster] == nil {
+			return fmt.Errorf("invalid webhook %s: unknown target cluster %s", webhook.Name, webhook.Cluster)
+		}
+	}
+	// The webhooks and the secret are watched through the Reader if it is a cache,
+	// and through a cache per object otherwise.
+	var objCache watchCache
+	if c, ok := cr.Reader.(cache.Cache); ok {
+		objCache = sharedCache{c}
+	} else {
+		caches, err := addObjectCaches(mgr, cr, "", mgr.GetConfig(), mgr.GetRESTMapper())
+		if err != nil {
+			return fmt.Errorf("creating object caches: %w", err)
+		}
+		objCache = caches
 	}
 
-	cr.reader = cache
-	cr.writer = mgr.GetClient() // TODO make overrideable
+	cr.reader = cr.Reader
+	if cr.reader == nil {
+		cr.reader = objCache
+	}
+	cr.writer = cr.Writer
+	if cr.writer == nil {
+		cr.writer = mgr.GetClient()
+	}
+	// Certs are refreshed from the live secret rather than the cache, so that a CA
+	// rotated by another replica is not rotated again.
+	cr.apiReader = cr.APIReader
+	if cr.apiReader == nil {
+		cr.apiReader = mgr.GetAPIReader()
+	}
+	targetClusters, err := addTargetClusters(mgr, cr)
+	if err != nil {
+		return err
+	}
 	cr.certsMounted = make(chan struct{})
 	cr.certsNotMounted = make(chan struct{})
-	cr.wasCAInjected = atomic.NewBool(false)
 	cr.caNotInjected = make(chan struct{})
+	cr.pendingWatches = newPendingWatches()
+	cr.webhookStatuses = newWebhookStatuses(cr.Webhooks)
+	cr.webhookServices = newWebhookServices()
 	if !cr.testNoBackgroundRotation {
 		if err := mgr.Add(cr); err != nil {
 			return err
 		}
+		if cr.RequireLeaderElection {
+			cr.elected = mgr.Elected()
+			if err := mgr.Add(&replicaRotator{cr: cr}); err != nil {
+				return err
+			}
+		}
 	}
 	if cr.ControllerName == "" {
 		cr.ControllerName = defaultControllerName
 	}
-	if cr.CertName == "" {
-		cr.CertName = defaultCertName
-	}
-
-	if cr.KeyName == "" {
-		cr.KeyName = defaultKeyName
-	}
-
 	if cr.CaCertDuration == time.Duration(0) {
 		cr.CaCertDuration = defaultCaCertValidityDuration
 	}
@@ -165,13 +252,24 @@ func AddRotator(mgr manager.Manager, cr *CertRotator) error {
 		cr.ExtKeyUsages = &[]x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
 	}
 
+	if cr.ClusterDomain == "" {
+		cr.ClusterDomain = defaultClusterDomain
+	}
+
 	reconciler := &ReconcileWH{
-		cache:                       cache,
-		writer:                      mgr.GetClient(), // TODO
+		cache:                       objCache,
+		reader:                      cr.reader,
+		writer:                      cr.writer,
 		scheme:                      mgr.GetScheme(),
+		mapper:                      mgr.GetRESTMapper(),
+		targetClusters:              targetClusters,
+		pendingWatches:              cr.pendingWatches,
+		webhookStatuses:             cr.webhookStatuses,
+		webhookServices:             cr.webhookServices,
+		servicesFromWebhooks:        cr.ServicesFromWebhooks,
+		otherSecrets:                sets.New(cr.otherSecretKeys()...),
 		ctx:                         context.Background(),
 		secretKey:                   cr.SecretKey,
-		wasCAInjected:               cr.wasCAInjected,
 		webhooks:                    cr.Webhooks,
 		needLeaderElection:          cr.RequireLeaderElection,
 		refreshCertIfNeededDelegate: cr.refreshCertIfNeeded,
@@ -180,40 +278,52 @@ func AddRotator(mgr manager.Manager, cr *CertRotator) error {
 		certsNotMounted:             cr.certsNotMounted,
 		enableReadinessCheck:        cr.EnableReadinessCheck,
 	}
+	if cr.ServicesFromWebhooks {
+		cr.discoverWebhookServices = reconciler.updateWebhookServices
+	}
 	if err := addController(mgr, reconciler, cr.ControllerName); err != nil {
 		return err
 	}
 	return nil
 }
 
-// addNamespacedCache will add a new namespace-scoped cache.Cache to the provided manager.
-// Informers in the new cache will be scoped to the provided namespace for namespaced resources,
-// but will still have cluster-wide visibility into cluster-scoped resources.
-// The cache will be started by the manager when it starts, and consumers should synchronize on
-// it using WaitForCacheSync().
-func addNamespacedCache(mgr manager.Manager, cr *CertRotator, namespace string) (cache.Cache, error) {
-	var namespaces map[string]cache.Config
-	if namespace != "" {
-		namespaces = map[string]cache.Config{
-			namespace: {},
-		}
-	}
+// targetCluster is a cluster other than the cluster of the manager whose webhooks are
+// injected by the rotator.
+type targetCluster struct {
+	cache  watchCache
+	reader SyncingReader
+	writer client.Writer
+	mapper meta.RESTMapper
+}
 
-	c, err := cache.New(mgr.GetConfig(),
-		cache.Options{
-			Scheme:            mgr.GetScheme(),
-			Mapper:            mgr.GetRESTMapper(),
-			DefaultNamespaces: namespaces,
-		})
-	if err != nil {
-		return nil, err
-	}
-	// Wrapping the cache to make sure it's also started when the manager
-	// hasn't been leader elected and CertRotator.RequireLeaderElection is false.
-	if err := mgr.Add(&cacheWrapper{Cache: c, needLeaderElection: cr.RequireLeaderElection}); err != nil {
-		return nil, fmt.Errorf("registering namespaced cache: %w", err)
+// addTargetClusters adds the object caches to the manager for every target cluster of the
+// webhooks, and returns the target clusters by name.
+func addTargetClusters(mgr manager.Manager, cr *CertRotator) (map[string]*targetCluster, error) {
+	clusters := make(map[string]*targetCluster)
+	for _, webhook := range cr.Webhooks {
+		if webhook.Cluster == "" || clusters[webhook.Cluster] != nil {
+			continue
+		}
+		config := cr.TargetClusters[webhook.Cluster]
+		httpClient, err := rest.HTTPClientFor(config)
+		if err != nil {
+			return nil, fmt.Errorf("creating HTTP client for target cluster %s: %w", webhook.Cluster, err)
+		}
+		mapper, err := apiutil.NewDynamicRESTMapper(config, httpClient)
+		if err != nil {
+			return nil, fmt.Errorf("creating REST mapper for target cluster %s: %w", webhook.Cluster, err)
+		}
+		c, err := addObjectCaches(mgr, cr, webhook.Cluster, config, mapper)
+		if err != nil {
+			return nil, fmt.Errorf("creating caches for target cluster %s: %w", webhook.Cluster, err)
+		}
+		writer, err := client.New(config, client.Options{HTTPClient: httpClient, Scheme: mgr.GetScheme(), Mapper: mapper})
+		if err != nil {
+			return nil, fmt.Errorf("creating client for target cluster %s: %w", webhook.Cluster, err)
+		}
+		clusters[webhook.Cluster] = &targetCluster{cache: c, reader: c, writer: writer, mapper: mapper}
 	}
-	return c, nil
+	return clusters, nil
 }
 
 // SyncingReader is a reader that needs syncing prior to being usable.
@@ -224,10 +334,44 @@ type SyncingReader interface {
 
 // CertRotator contains cert artifacts and a channel to close when the certs are ready.
 type CertRotator struct {
-	reader SyncingReader
-	writer client.Writer
-
-	SecretKey      types.NamespacedName
+	reader    SyncingReader
+	writer    client.Writer
+	apiReader client.Reader
+	// refreshMu serializes cert refreshes by the rotation loop and the reconciler.
+	refreshMu sync.Mutex
+
+	// Reader is the optional reader of the secret and the webhooks. If it is a cache.Cache,
+	// it is also used to watch them, and must be started by the caller, e.g. the cache of
+	// the manager. Defaults to a cache restricted to the objects managed by the rotator.
+	Reader SyncingReader
+	// Writer is the optional writer of the secret and the webhooks, e.g. a client with
+	// impersonation or its own rate limiter. Defaults to the client of the manager.
+	Writer client.Writer
+	// APIReader is the optional reader the secrets are read from before the certs are
+	// refreshed. It must read from the API server rather than a cache, as a stale secret would
+	// rotate a CA already rotated by another replica. Defaults to the API reader of the manager.
+	APIReader client.Reader
+	// TargetClusters are the configs of the clusters other than the cluster of the manager,
+	// by name, whose webhooks are injected when their Cluster is set, e.g. the guest cluster
+	// of a hosted control plane. The secret is always stored in the cluster of the manager,
+	// and Reader and Writer only apply to it.
+	TargetClusters map[string]*rest.Config
+
+	SecretKey types.NamespacedName
+	// CASecretKey is the optional secret the CA cert and key are stored in, under ca.crt and
+	// ca.key, so that the CA key is not mounted in the pods serving the webhooks. The secret
+	// must exist and differ from SecretKey, and its namespace defaults to the namespace of
+	// SecretKey. The secret of the CertRotator then only holds the server cert and the CA
+	// cert, and a CA it still holds is moved to the CA secret.
+	CASecretKey types.NamespacedName
+	// Keystore optionally adds PKCS#12 or JKS keystores of the server cert to the secret.
+	Keystore *Keystore
+	// OutputFormats optionally adds other encodings of the server cert and a bundle of the
+	// trusted CA certs to the secret.
+	OutputFormats *OutputFormats
+	// KeyProtector optionally encrypts the CA key stored in the secret of the CA, e.g. with
+	// NewFileKeyProtector. A CA key stored in plaintext is encrypted rather than rotated.
+	KeyProtector   KeyProtector
 	CertDir        string
 	CAName         string
 	CAOrganization string
@@ -239,8 +383,47 @@ type CertRotator struct {
 	FieldOwner             string
 	RestartOnSecretRefresh bool
 	ExtKeyUsages           *[]x509.ExtKeyUsage
+	// Services are the Services serving the webhooks. Their DNS names, from `<name>` to
+	// `<name>.<namespace>.svc.<ClusterDomain>`, are added to the server cert.
+	Services []types.NamespacedName
+	// ServicesFromWebhooks adds the DNS names of the Services referenced by the `clientConfig.service`
+	// of the webhooks, or the `spec.service` of APIServices, to the server cert. The server cert is
+	// re-issued when they change.
+	ServicesFromWebhooks bool
+	// ClusterDomain is the domain of the cluster used in the DNS names of Services.
+	// Defaults to cluster.local.
+	ClusterDomain string
+	// IPAddresses are the IP addresses of the server cert, e.g. the ClusterIP of the webhook Service.
+	IPAddresses []net.IP
+	// URIs are the URIs of the server cert, e.g. a SPIFFE ID such as
+	// spiffe://cluster.local/ns/<namespace>/sa/<service account>.
+	URIs []*url.URL
+	// EmailAddresses are the email addresses of the server cert.
+	EmailAddresses []string
+	// ServerCerts are additional server certificates issued by the CA, e.g. for other servers
+	// of the same component, so that all of them trust a single CA and are rotated together.
+	ServerCerts []ServerCert
+	// ClientCerts are client certificates for mutual TLS issued by the CA, each stored in its
+	// own secret and refreshed along with the server cert.
+	ClientCerts []ClientCert
+	// CASubject is the optional subject of the CA cert. Its CommonName and Organization
+	// default to CAName and CAOrganization.
+	CASubject *pkix.Name
+	// ServerSubject is the optional subject of the server cert. Its CommonName defaults
+	// to DNSName, or to the first DNS name of the server cert.
+	ServerSubject *pkix.Name
+	// CANameConstraints restricts the CA cert with X.509 name constraints to the subject
+	// alternative names of the server certs and to PermittedDNSDomains, so that a leaked CA
+	// key cannot be used to issue certs for other hosts. The CA is rotated when they change.
+	// URIs of the server certs must then have a host, e.g. spiffe://cluster.local/ns/ns/sa/sa.
+	CANameConstraints bool
+	// PermittedDNSDomains are additional DNS domains, including their subdomains, the CA
+	// may issue certs for when CANameConstraints is set.
+	PermittedDNSDomains []string
 	// RequireLeaderElection should be set to true if the CertRotator needs to
-	// be run in the leader election mode.
+	// be run in the leader election mode. Only the leader then rotates the certs and
+	// injects the CA cert into the webhooks, while every replica verifies that its
+	// mounted certs match the secret before closing IsReady.
 	RequireLeaderElection bool
 	// CaCertDuration sets how long a CA cert will be valid for.
 	CaCertDuration time.Duration
@@ -258,14 +441,26 @@ type CertRotator struct {
 	// runnable to finish execution.
 	EnableReadinessCheck bool
 
+	// RequireAllWebhooksInjected if true, IsReady is only closed once every webhook that is
+	// not Optional carries the current CA cert, instead of after the first successful reconcile.
+	// IsReady stays open while such a webhook waits for its kind to be served.
+	RequireAllWebhooksInjected bool
+
 	// ControllerName allows registering multiple cert-rotator controllers.
 	// Use the default value unless rotating multiple certificate secrets.
 	ControllerName string
 
 	certsMounted    chan struct{}
 	certsNotMounted chan struct{}
-	wasCAInjected   *atomic.Bool
 	caNotInjected   chan struct{}
+	readyOnce       sync.Once
+	elected         <-chan struct{}
+	pendingWatches  *pendingWatches
+	webhookStatuses *webhookStatuses
+	webhookServices *webhookServices
+	// discoverWebhookServices updates the Services of the webhooks before the certs are first
+	// refreshed, when ServicesFromWebhooks is true.
+	discoverWebhookServices func()
 
 	// testNoBackgroundRotation doesn't actually start the rotator in the background.
 	// This should only be used for testing.
@@ -276,6 +471,65 @@ func (cr *CertRotator) NeedLeaderElection() bool {
 	return cr.RequireLeaderElection
 }
 
+// leading returns true if the replica rotates the certs and injects the webhooks, i.e. if it is
+// the elected leader or leader election is not required.
+func (cr *CertRotator) leading() bool {
+	if !cr.RequireLeaderElection || cr.elected == nil {
+		return true
+	}
+	select {
+	case <-cr.elected:
+		return true
+	default:
+		return false
+	}
+}
+
+// WebhookStatuses returns the status of the CA cert injection into every webhook,
+// in the order of Webhooks.
+func (cr *CertRotator) WebhookStatuses() []WebhookStatus {
+	if cr.webhookStatuses == nil {
+		return nil
+	}
+	return cr.webhookStatuses.list()
+}
+
+// CheckWebhooks returns an error if any webhook that is not Optional does not carry the current
+// CA cert, e.g. because it was not injected yet or its CA bundle was edited. Unlike IsReady,
+// which is closed once, it reflects the current state, and can be used as a readiness check:
+//
+//	mgr.AddReadyzCheck("webhooks", cr.CheckWebhooks)
+//
+// When RequireLeaderElection is true, only the leader injects the webhooks, so on the other
+// replicas it checks the mounted certs instead, as CheckCerts does.
+func (cr *CertRotator) CheckWebhooks(req *http.Request) error {
+	if cr.webhookStatuses == nil {
+		return errors.New("cert rotator is not added to a manager")
+	}
+	if !cr.leading() {
+		return cr.CheckCerts(req)
+	}
+	notCurrent := cr.webhookStatuses.notCurrent()
+	if len(notCurrent) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(notCurrent))
+	for _, status := range notCurrent {
+		names = append(names, fmt.Sprintf("%s (%s)", status.Webhook.Name, status.State))
+	}
+	return fmt.Errorf("webhooks do not carry the current CA cert: %s", strings.Join(names, ", "))
+}
+
+// PendingWebhooks returns the webhooks whose kind is not served by the API server yet,
+// e.g. because their CRD has not been installed. CRDs are not watched: the API server is
+// polled for their kind every minute, and they are watched and injected once it is served.
+func (cr *CertRotator) PendingWebhooks() []WebhookInfo {
+	if cr.pendingWatches == nil {
+		return nil
+	}
+	return cr.pendingWatches.list()
+}
+
 // Start starts the CertRotator runnable to rotate certs and ensure the certs are ready.
 func (cr *CertRotator) Start(ctx context.Context) error {
 	if cr.reader == nil {
@@ -289,14 +543,17 @@ func (cr *CertRotator) Start(ctx context.Context) error {
 	// can be bootstrapped, otherwise manager exits before a cert can be written
 	crLog.Info("starting cert rotator controller")
 	defer crLog.Info("stopping cert rotator controller")
-	if _, err := cr.refreshCertIfNeeded(); err != nil {
+	if err := cr.refreshCertOnStart(); err != nil {
 		crLog.Error(err, "could not refresh cert on startup")
 		return err
 	}
 
-	// Once the certs are ready, close the channel.
-	go cr.ensureCertsMounted()
-	go cr.ensureReady()
+	// Once the certs are ready, close the channel. With leader election, the certs
+	// mounted on every replica are checked by the replicaRotator.
+	if !cr.RequireLeaderElection {
+		go cr.ensureCertsMounted()
+	}
+	go cr.ensureReady(ctx)
 
 	ticker := time.NewTicker(cr.RotationCheckFrequency)
 
@@ -320,19 +577,61 @@ tickerLoop:
 	return nil
 }
 
-// refreshCertIfNeeded returns true if the CA was rotated
-// and if there's any error when rotating the CA or refreshing the certs.
+// refreshCertOnStart refreshes the certs when the rotator starts. The Services of the webhooks
+// are discovered first, so that a server cert issued for them is not re-issued without them.
+func (cr *CertRotator) refreshCertOnStart() error {
+	if cr.discoverWebhookServices != nil {
+		cr.discoverWebhookServices()
+	}
+	_, err := cr.refreshCertIfNeeded()
+	return err
+}
+
+// refreshCertIfNeeded refreshes the certs of the secret if they are not valid, and returns
+// true if the CA was rotated. The secret is read from the API server and updated with its
+// resourceVersion as a precondition, so that when another replica updates it concurrently,
+// the update fails with a conflict and the certs written by the other replica are re-checked
+// instead of being rotated again.
 func (cr *CertRotator) refreshCertIfNeeded() (bool, error) {
+	cr.refreshMu.Lock()
+	defer cr.refreshMu.Unlock()
 	var rotatedCA bool
 
 	refreshFn := func() (bool, error) {
 		secret := &corev1.Secret{}
-		if err := cr.reader.Get(context.Background(), cr.SecretKey, secret); err != nil {
+		if err := cr.apiReader.Get(context.Background(), cr.SecretKey, secret); err != nil {
 			return false, errors.Wrap(err, "acquiring secret to update certificates")
 		}
-		if secret.Data == nil || !cr.validCACert(secret.Data[caCertName], secret.Data[caKeyName]) {
+		caSecret := secret
+		if cr.separateCASecret() {
+			caSecret = &corev1.Secret{}
+			if err := cr.apiReader.Get(context.Background(), cr.CASecretKey, caSecret); err != nil {
+				return false, errors.Wrap(err, "acquiring CA secret to update certificates")
+			}
+			if adopted, err := cr.adoptCA(caSecret, secret); err != nil {
+				if k8sErrors.IsConflict(err) {
+					crLog.Info("CA secret was updated concurrently, re-checking certs")
+					return false, nil
+				}
+				crLog.Error(err, "could not move the CA to its secret")
+				return false, nil
+			} else if adopted {
+				crLog.Info("moved the CA to its secret", "secret", cr.CASecretKey)
+			}
+		}
+		// The CA is not rotated when its key cannot be decrypted, e.g. because the key
+		// management service is unavailable.
+		caKey, err := cr.caKeyPEM(caSecret)
+		if err != nil {
+			return false, err
+		}
+		if caSecret.Data == nil || !cr.validCACert(caSecret.Data[caCertName], caKey) {
 			crLog.Info("refreshing CA and server certs")
-			if err := cr.refreshCerts(true, secret); err != nil {
+			if err := cr.refreshCerts(true, caSecret, secret); err != nil {
+				if k8sErrors.IsConflict(err) {
+					crLog.Info("secret was updated concurrently, re-checking certs")
+					return false, nil
+				}
 				crLog.Error(err, "could not refresh CA and server certs")
 				return false, nil
 			}
@@ -344,13 +643,39 @@ func (cr *CertRotator) refreshCertIfNeeded() (bool, error) {
 			}
 			return true, nil
 		}
+		if cr.plaintextCAKey(caSecret) {
+			crLog.Info("encrypting the CA key")
+			caArtifacts, err := cr.caArtifacts(caSecret)
+			if err != nil {
+				return false, err
+			}
+			if err := cr.writeCASecret(caArtifacts, caSecret); err != nil {
+				if k8sErrors.IsConflict(err) {
+					crLog.Info("secret was updated concurrently, re-checking certs")
+					return false, nil
+				}
+				crLog.Error(err, "could not encrypt the CA key")
+				return false, nil
+			}
+			// Re-check the certs with the updated secrets.
+			return false, nil
+		}
 		// make sure our reconciler is initialized on startup (either this or the above refreshCerts() will call this)
-		if !cr.validServerCert(secret.Data[caCertName], secret.Data[cr.CertName], secret.Data[cr.KeyName]) {
+		// The server cert is also re-issued when the secret does not hold the CA cert of the CA
+		// secret, as the secret of the CA was written first.
+		staleCA := !bytes.Equal(secret.Data[caCertName], caSecret.Data[caCertName])
+		if staleCA || !cr.validServerCert(secret.Data[caCertName], secret.Data[cr.CertName], secret.Data[cr.KeyName]) {
 			crLog.Info("refreshing server certs")
-			if err := cr.refreshCerts(false, secret); err != nil {
+			if err := cr.refreshCerts(false, caSecret, secret); err != nil {
+				if k8sErrors.IsConflict(err) {
+					crLog.Info("secret was updated concurrently, re-checking certs")
+					return false, nil
+				}
 				crLog.Error(err, "could not refresh server certs")
 				return false, nil
 			}
+			// The webhooks are injected with the CA cert of the secret read before the refresh.
+			rotatedCA = rotatedCA || staleCA
 			crLog.Info("server certs refreshed")
 			if cr.RestartOnSecretRefresh {
 				crLog.Info("Secrets have been updated; exiting so pod can be restarted (This behaviour can be changed with the option RestartOnSecretRefresh)")
@@ -358,6 +683,37 @@ func (cr *CertRotator) refreshCertIfNeeded() (bool, error) {
 			}
 			return true, nil
 		}
+		// The CA key is removed from the secret once the CA secret holds it, e.g. after the CA
+		// was moved to it, without re-issuing the server cert or restarting the pod.
+		if cr.separateCASecret() && secret.Data[caKeyName] != nil && caSecret.Data[caKeyName] != nil {
+			crLog.Info("removing the CA key from the secret")
+			if err := cr.removeCAKey(secret); err != nil {
+				if k8sErrors.IsConflict(err) {
+					crLog.Info("secret was updated concurrently, re-checking certs")
+					return false, nil
+				}
+				crLog.Error(err, "could not remove the CA key from the secret")
+				return false, nil
+			}
+			// Re-check the certs with the updated secret.
+			return false, nil
+		}
+		// The keystores and outputs are re-encoded from the valid server cert, e.g. when their
+		// password changes or a previous CA cert of the CA bundle expires, so that the server
+		// cert is not re-issued and the pod is not restarted.
+		if !cr.validEncodings(secret) {
+			crLog.Info("refreshing keystores and outputs")
+			if err := cr.refreshEncodings(secret); err != nil {
+				if k8sErrors.IsConflict(err) {
+					crLog.Info("secret was updated concurrently, re-checking certs")
+					return false, nil
+				}
+				crLog.Error(err, "could not refresh keystores and outputs")
+				return false, nil
+			}
+			crLog.Info("keystores and outputs refreshed")
+			return true, nil
+		}
 		crLog.Info("no cert refresh needed")
 		return true, nil
 	}
@@ -369,13 +725,20 @@ func (cr *CertRotator) refreshCertIfNeeded() (bool, error) {
 	}, refreshFn); err != nil {
 		return rotatedCA, err
 	}
+	if len(cr.ServerCerts) > 0 || len(cr.ClientCerts) > 0 {
+		if err := cr.refreshLeafCertsIfNeeded(); err != nil {
+			return rotatedCA, err
+		}
+	}
 	return rotatedCA, nil
 }
 
-func (cr *CertRotator) refreshCerts(refreshCA bool, secret *corev1.Secret) error {
+// refreshCerts issues the server cert, and the CA if refreshCA is true. The CA secret is the
+// secret itself unless CASecretKey is set, in which case the CA is written to it first.
+func (cr *CertRotator) refreshCerts(refreshCA bool, caSecret, secret *corev1.Secret) error {
 	var caArtifacts *KeyPairArtifacts
 	now := time.Now()
-	begin := now.Add(-1 * time.Hour)
+	begin := now.Add(-certBackdate)
 	if refreshCA {
 		end := now.Add(cr.CaCertDuration)
 		var err error
@@ -383,9 +746,14 @@ func (cr *CertRotator) refreshCerts(refreshCA bool, secret *corev1.Secret) error
 		if err != nil {
 			return err
 		}
+		if caSecret != secret {
+			if err := cr.writeCASecret(caArtifacts, caSecret); err != nil {
+				return err
+			}
+		}
 	} else {
 		var err error
-		caArtifacts, err = buildArtifactsFromSecret(secret)
+		caArtifacts, err = cr.caArtifacts(caSecret)
 		if err != nil {
 			return err
 		}
@@ -401,93 +769,19 @@ func (cr *CertRotator) refreshCerts(refreshCA bool, secret *corev1.Secret) error
 	return nil
 }
 
-func injectCert(updatedResource *unstructured.Unstructured, certPem []byte, webhookType WebhookType) error {
-	switch webhookType {
-	case Validating:
-		return injectCertToWebhook(updatedResource, certPem)
-	case Mutating:
-		return injectCertToWebhook(updatedResource, certPem)
-	case CRDConversion:
-		return injectCertToConversionWebhook(updatedResource, certPem)
-	case APIService:
-		return injectCertToApiService(updatedResource, certPem)
-	case ExternalDataProvider:
-		return injectCertToExternalDataProvider(updatedResource, certPem)
-	}
-	return fmt.Errorf("incorrect webhook type")
-}
-
-func injectCertToWebhook(wh *unstructured.Unstructured, certPem []byte) error {
-	webhooks, found, err := unstructured.NestedSlice(wh.Object, "webhooks")
-	if err != nil {
-		return err
-	}
-	if !found {
-		return nil
-	}
-	for i, h := range webhooks {
-		hook, ok := h.(map[string]interface{})
-		if !ok {
-			return errors.Errorf("webhook %d is not well-formed", i)
-		}
-		if err := unstructured.SetNestedField(hook, base64.StdEncoding.EncodeToString(certPem), "clientConfig", "caBundle"); err != nil {
+func (cr *CertRotator) writeSecret(cert, key []byte, caArtifacts *KeyPairArtifacts, secret *corev1.Secret) error {
+	populateSecret(cert, key, cr.CertName, cr.KeyName, caArtifacts, cr.OutputFormats, secret)
+	if cr.Keystore != nil {
+		if err := cr.populateKeystores(cert, key, caArtifacts.CertPEM, secret); err != nil {
 			return err
 		}
-		webhooks[i] = hook
-	}
-	if err := unstructured.SetNestedSlice(wh.Object, webhooks, "webhooks"); err != nil {
-		return err
-	}
-	return nil
-}
-
-func injectCertToConversionWebhook(crd *unstructured.Unstructured, certPem []byte) error {
-	_, found, err := unstructured.NestedMap(crd.Object, "spec", "conversion", "webhook", "clientConfig")
-	if err != nil {
-		return err
-	}
-	if !found {
-		return errors.New("`conversion.webhook.clientConfig` field not found in CustomResourceDefinition")
-	}
-	if err := unstructured.SetNestedField(crd.Object, base64.StdEncoding.EncodeToString(certPem), "spec", "conversion", "webhook", "clientConfig", "caBundle"); err != nil {
-		return err
-	}
-
-	return nil
-}
-
-func injectCertToApiService(apiService *unstructured.Unstructured, certPem []byte) error {
-	_, found, err := unstructured.NestedMap(apiService.Object, "spec")
-	if err != nil {
-		return err
-	}
-	if !found {
-		return errors.New("`spec` field not found in APIService")
-	}
-	if err := unstructured.SetNestedField(apiService.Object, base64.StdEncoding.EncodeToString(certPem), "spec", "caBundle"); err != nil {
-		return err
-	}
-
-	return nil
-}
-
-func injectCertToExternalDataProvider(externalDataProvider *unstructured.Unstructured, certPem []byte) error {
-	_, found, err := unstructured.NestedMap(externalDataProvider.Object, "spec")
-	if err != nil {
-		return err
 	}
-	if !found {
-		return errors.New("`spec` field not found in Provider")
-	}
-	if err := unstructured.SetNestedField(externalDataProvider.Object, base64.StdEncoding.EncodeToString(certPem), "spec", "caBundle"); err != nil {
+	if cr.separateCASecret() {
+		// Only the CA secret holds the CA key.
+		delete(secret.Data, caKeyName)
+	} else if err := cr.protectCAKey(caArtifacts, secret); err != nil {
 		return err
 	}
-
-	return nil
-}
-
-func (cr *CertRotator) writeSecret(cert, key []byte, caArtifacts *KeyPairArtifacts, secret *corev1.Secret) error {
-	populateSecret(cert, key, cr.CertName, cr.KeyName, caArtifacts, secret)
 	return cr.writer.Update(context.Background(), secret)
 }
 
@@ -499,10 +793,13 @@ type KeyPairArtifacts struct {
 	KeyPEM  []byte
 }
 
-func populateSecret(cert, key []byte, certName string, keyName string, caArtifacts *KeyPairArtifacts, secret *corev1.Secret) {
+func populateSecret(cert, key []byte, certName string, keyName string, caArtifacts *KeyPairArtifacts, outputs *OutputFormats, secret *corev1.Secret) {
 	if secret.Data == nil {
 		secret.Data = make(map[string][]byte)
 	}
+	if outputs != nil {
+		populateOutputs(outputs, cert, key, caArtifacts.CertPEM, secret)
+	}
 	secret.Data[caCertName] = caArtifacts.CertPEM
 	secret.Data[caKeyName] = caArtifacts.KeyPEM
 	secret.Data[certName] = cert
@@ -545,22 +842,20 @@ func buildArtifactsFromSecret(secret *corev1.Secret) (*KeyPairArtifacts, error)
 // CreateCACert creates the self-signed CA cert and private key that will
 // be used to sign the server certificate.
 func (cr *CertRotator) CreateCACert(begin, end time.Time) (*KeyPairArtifacts, error) {
+	serial, err := newSerialNumber()
+	if err != nil {
+		return nil, err
+	}
 	templ := &x509.Certificate{
-		SerialNumber: big.NewInt(0),
-		Subject: pkix.Name{
-			CommonName:   cr.CAName,
-			Organization: []string{cr.CAOrganization},
-		},
-		DNSNames: []string{
-			cr.CAName,
-		},
+		SerialNumber:          serial,
 		NotBefore:             begin,
 		NotAfter:              end,
 		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment | x509.KeyUsageCertSign,
 		BasicConstraintsValid: true,
 		IsCA:                  true,
 	}
-	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	cr.caCertSpec().template(templ)
+	key, err := rsa.GenerateKey(rand.Reader, rsaKeySize)
 	if err != nil {
 		return nil, errors.Wrap(err, "generating key")
 	}
@@ -583,21 +878,19 @@ func (cr *CertRotator) CreateCACert(begin, end time.Time) (*KeyPairArtifacts, er
 // CreateCertPEM takes the results of CreateCACert and uses it to create the
 // PEM-encoded public certificate and private key, respectively.
 func (cr *CertRotator) CreateCertPEM(ca *KeyPairArtifacts, begin, end time.Time) ([]byte, []byte, error) {
-	dnsNames := []string{cr.DNSName}
-	dnsNames = append(dnsNames, cr.ExtraDNSNames...)
-	templ := &x509.Certificate{
-		SerialNumber: big.NewInt(1),
-		Subject: pkix.Name{
-			CommonName: cr.DNSName,
-		},
-		DNSNames:              dnsNames,
-		NotBefore:             begin,
-		NotAfter:              end,
-		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
-		ExtKeyUsage:           *cr.ExtKeyUsages,
-		BasicConstraintsValid: true,
+	return createCertPEM(ca, cr.serverCertSpec(), begin, end)
+}
+
+// createCertPEM creates the PEM-encoded public certificate and private key of
+// a cert of the spec signed by the CA.
+func createCertPEM(ca *KeyPairArtifacts, spec certSpec, begin, end time.Time) ([]byte, []byte, error) {
+	templ := spec.template(begin, end)
+	serial, err := newSerialNumber()
+	if err != nil {
+		return nil, nil, err
 	}
-	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	templ.SerialNumber = serial
+	key, err := rsa.GenerateKey(rand.Reader, rsaKeySize)
 	if err != nil {
 		return nil, nil, errors.Wrap(err, "generating key")
 	}
@@ -629,20 +922,50 @@ func (cr *CertRotator) lookaheadTime() time.Time {
 	return time.Now().Add(cr.LookaheadInterval)
 }
 
+// validServerCert returns true if the server cert is valid and matches its desired spec,
+// so that it is re-issued when the configuration of the CertRotator changes.
 func (cr *CertRotator) validServerCert(caCert, cert, key []byte) bool {
-	valid, err := ValidCert(caCert, cert, key, cr.DNSName, cr.ExtKeyUsages, cr.lookaheadTime())
+	spec := cr.serverCertSpec()
+	var dnsName string
+	if len(spec.dnsNames) > 0 {
+		dnsName = spec.dnsNames[0]
+	}
+	valid, err := ValidCert(caCert, cert, key, dnsName, cr.ExtKeyUsages, cr.lookaheadTime())
+	if err != nil || !valid {
+		return false
+	}
+	crt, err := parseCertPEM(cert)
 	if err != nil {
 		return false
 	}
-	return valid
+	if changed := spec.changed(crt); changed != "" {
+		crLog.Info("server cert differs from its desired spec", "attribute", changed)
+		return false
+	}
+	return true
 }
 
+// validCACert returns true if the CA cert is valid and matches its desired spec, so that
+// the CA is rotated when its subject or name constraints change.
 func (cr *CertRotator) validCACert(cert, key []byte) bool {
-	valid, err := ValidCert(cert, cert, key, cr.CAName, nil, cr.lookaheadTime())
+	spec := cr.caCertSpec()
+	var dnsName string
+	if len(spec.dnsNames) > 0 {
+		dnsName = spec.dnsNames[0]
+	}
+	valid, err := ValidCert(cert, cert, key, dnsName, nil, cr.lookaheadTime())
+	if err != nil || !valid {
+		return false
+	}
+	crt, err := parseCertPEM(cert)
 	if err != nil {
 		return false
 	}
-	return valid
+	if changed := spec.changed(crt); changed != "" {
+		crLog.Info("CA cert differs from its desired spec", "attribute", changed)
+		return false
+	}
+	return true
 }
 
 func ValidCert(caCert, cert, key []byte, dnsName string, keyUsages *[]x509.ExtKeyUsage, at time.Time) (bool, error) {
@@ -692,9 +1015,20 @@ func ValidCert(caCert, cert, key []byte, dnsName string, keyUsages *[]x509.ExtKe
 	return true, nil
 }
 
+// reconcileSecretMapFunc reconciles the secret when it, the secret of the CA or the secret of a leaf cert changes.
+func reconcileSecretMapFunc(r *ReconcileWH) func(ctx context.Context, secret *corev1.Secret) []reconcile.Request {
+	return func(ctx context.Context, secret *corev1.Secret) []reconcile.Request {
+		key := types.NamespacedName{Namespace: secret.GetNamespace(), Name: secret.GetName()}
+		if key != r.secretKey && !r.otherSecrets.Has(key) {
+			return nil
+		}
+		return []reconcile.Request{{NamespacedName: r.secretKey}}
+	}
+}
+
 func reconcileSecretAndWebhookMapFunc(webhook WebhookInfo, r *ReconcileWH) func(ctx context.Context, object *unstructured.Unstructured) []reconcile.Request {
 	return func(ctx context.Context, object *unstructured.Unstructured) []reconcile.Request {
-		whKey := types.NamespacedName{Name: webhook.Name}
+		whKey := webhook.key(r.secretKey.Namespace)
 		if object.GetNamespace() != whKey.Namespace {
 			return nil
 		}
@@ -713,40 +1047,135 @@ func addController(mgr manager.Manager, r *ReconcileWH, controllerName string) e
 		return err
 	}
 
-	err = c.Watch(
-		source.Kind(r.cache, &corev1.Secret{}, &handler.TypedEnqueueRequestForObject[*corev1.Secret]{}),
-	)
-	if err != nil {
-		return fmt.Errorf("watching Secrets: %w", err)
-	}
-
-	for _, webhook := range r.webhooks {
-		wh := &unstructured.Unstructured{}
-		wh.SetGroupVersionKind(webhook.gvk())
+	// The secrets are watched once per cache, as they may share one.
+	watched := make(map[cache.Cache]bool)
+	for _, key := range append([]types.NamespacedName{r.secretKey}, r.otherSecrets.UnsortedList()...) {
+		secretCache, err := r.cache.forObject(&corev1.Secret{}, key)
+		if err != nil {
+			return fmt.Errorf("watching secret %s: %w", key, err)
+		}
+		if watched[secretCache] {
+			continue
+		}
+		watched[secretCache] = true
 		err = c.Watch(
-			source.Kind(r.cache, wh, handler.TypedEnqueueRequestsFromMapFunc(reconcileSecretAndWebhookMapFunc(webhook, r))),
+			source.Kind(secretCache, &corev1.Secret{}, handler.TypedEnqueueRequestsFromMapFunc(reconcileSecretMapFunc(r))),
 		)
+		if err != nil {
+			return fmt.Errorf("watching Secrets: %w", err)
+		}
+	}
 
+	r.controller = c
+	for i, webhook := range r.webhooks {
+		target, err := webhook.target()
+		if err != nil {
+			return err
+		}
+		gvk, err := target.resolveGVK(r.clusterOf(webhook).mapper)
+		if meta.IsNoMatchError(err) {
+			// The watch is started by the reconciler once the kind is served.
+			crLog.Error(err, "not watching webhook until its kind is served", "name", webhook.Name)
+			r.pendingWatches.add(i, webhook)
+			continue
+		}
 		if err != nil {
 			return fmt.Errorf("watching webhook %s: %w", webhook.Name, err)
 		}
+		if err := r.watchWebhook(webhook, gvk); err != nil {
+			return err
+		}
 	}
 
 	return mgr.Add(controllerWrapper{c, r.needLeaderElection})
 }
 
+func (r *ReconcileWH) watchWebhook(webhook WebhookInfo, gvk schema.GroupVersionKind) error {
+	wh := &unstructured.Unstructured{}
+	wh.SetGroupVersionKind(gvk)
+	whCache, err := r.clusterOf(webhook).cache.forObject(wh, webhook.key(r.secretKey.Namespace))
+	if err != nil {
+		return fmt.Errorf("watching webhook %s: %w", webhook.Name, err)
+	}
+	err = r.controller.Watch(
+		source.Kind(whCache, wh, handler.TypedEnqueueRequestsFromMapFunc(reconcileSecretAndWebhookMapFunc(webhook, r))),
+	)
+	if err != nil {
+		return fmt.Errorf("watching webhook %s: %w", webhook.Name, err)
+	}
+	return nil
+}
+
+// startPendingWatch starts watching the webhook at index i of r.webhooks if its
+// kind was not served when the controller was added.
+func (r *ReconcileWH) startPendingWatch(i int, gvk schema.GroupVersionKind) error {
+	r.pendingWatches.mu.Lock()
+	defer r.pendingWatches.mu.Unlock()
+	webhook, ok := r.pendingWatches.webhooks[i]
+	if !ok {
+		return nil
+	}
+	if err := r.watchWebhook(webhook, gvk); err != nil {
+		return err
+	}
+	crLog.Info("started watching webhook now that its kind is served", "name", webhook.Name, "gvk", gvk)
+	delete(r.pendingWatches.webhooks, i)
+	return nil
+}
+
+// pendingWatches tracks the webhooks that are not watched yet because their
+// kind was not served by the API server when the controller was added.
+type pendingWatches struct {
+	mu       sync.Mutex
+	webhooks map[int]WebhookInfo
+}
+
+func newPendingWatches() *pendingWatches {
+	return &pendingWatches{webhooks: make(map[int]WebhookInfo)}
+}
+
+func (p *pendingWatches) add(i int, webhook WebhookInfo) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.webhooks[i] = webhook
+}
+
+// list returns the pending webhooks in the order they were configured.
+func (p *pendingWatches) list() []WebhookInfo {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	indexes := make([]int, 0, len(p.webhooks))
+	for i := range p.webhooks {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+	webhooks := make([]WebhookInfo, 0, len(indexes))
+	for _, i := range indexes {
+		webhooks = append(webhooks, p.webhooks[i])
+	}
+	return webhooks
+}
+
 var _ reconcile.Reconciler = &ReconcileWH{}
 
 // ReconcileWH reconciles a validatingwebhookconfiguration, making sure it
 // has the appropriate CA cert.
 type ReconcileWH struct {
 	writer                      client.Writer
-	cache                       cache.Cache
+	reader                      SyncingReader
+	cache                       watchCache
 	scheme                      *runtime.Scheme
+	mapper                      meta.RESTMapper
+	targetClusters              map[string]*targetCluster
+	controller                  controller.Controller
+	pendingWatches              *pendingWatches
+	webhookStatuses             *webhookStatuses
+	webhookServices             *webhookServices
+	servicesFromWebhooks        bool
+	otherSecrets                sets.Set[types.NamespacedName]
 	ctx                         context.Context
 	secretKey                   types.NamespacedName
 	webhooks                    []WebhookInfo
-	wasCAInjected               *atomic.Bool
 	needLeaderElection          bool
 	refreshCertIfNeededDelegate func() (bool, error)
 	fieldOwner                  string
@@ -755,6 +1184,14 @@ type ReconcileWH struct {
 	enableReadinessCheck        bool
 }
 
+// clusterOf returns the cluster of the resource of the webhook.
+func (r *ReconcileWH) clusterOf(webhook WebhookInfo) *targetCluster {
+	if webhook.Cluster == "" {
+		return &targetCluster{cache: r.cache, reader: r.reader, writer: r.writer, mapper: r.mapper}
+	}
+	return r.targetClusters[webhook.Cluster]
+}
+
 // Reconcile reads that state of the cluster for a validatingwebhookconfiguration
 // object and makes sure the most recent CA cert is included.
 func (r *ReconcileWH) Reconcile(ctx context.Context, request reconcile.Request) (reconcile.Result, error) {
@@ -775,12 +1212,12 @@ func (r *ReconcileWH) Reconcile(ctx context.Context, request reconcile.Request)
 		}
 	}
 
-	if !r.cache.WaitForCacheSync(ctx) {
-		return reconcile.Result{}, errors.New("cache not ready")
+	if !r.reader.WaitForCacheSync(ctx) {
+		return reconcile.Result{}, errors.New("reader not ready")
 	}
 
 	secret := &corev1.Secret{}
-	if err := r.cache.Get(r.ctx, request.NamespacedName, secret); err != nil {
+	if err := r.reader.Get(r.ctx, request.NamespacedName, secret); err != nil {
 		if k8sErrors.IsNotFound(err) {
 			// Object not found, return.  Created objects are automatically garbage collected.
 			// For additional cleanup logic use finalizers.
@@ -791,6 +1228,11 @@ func (r *ReconcileWH) Reconcile(ctx context.Context, request reconcile.Request)
 	}
 
 	if secret.GetDeletionTimestamp().IsZero() {
+		// Update the Services of the webhooks first, so that the server cert is re-issued
+		// when they changed.
+		if r.servicesFromWebhooks {
+			r.updateWebhookServices()
+		}
 		if r.refreshCertIfNeededDelegate != nil {
 			rotatedCA, err := r.refreshCertIfNeededDelegate()
 			if err != nil {
@@ -804,73 +1246,152 @@ func (r *ReconcileWH) Reconcile(ctx context.Context, request reconcile.Request)
 			}
 		}
 
-		artifacts, err := buildArtifactsFromSecret(secret)
+		// The CA key is not needed to inject the CA cert, and is not in the secret when it
+		// is stored in a separate secret.
+		caCert, err := caCertFromSecret(secret)
 		if err != nil {
 			crLog.Error(err, "secret is not well-formed, cannot update webhook configurations")
 			return reconcile.Result{}, nil
 		}
 
-		// Ensure certs on webhooks
-		if err := r.ensureCerts(artifacts.CertPEM); err != nil {
-			return reconcile.Result{}, err
+		// Ensure certs on webhooks. Failed webhooks are retried by requeueing the request,
+		// while missing webhooks are injected once their watch observes them.
+		errs := r.ensureCerts(caCert)
+		if errs.hasState(InjectionFailed) {
+			return reconcile.Result{}, errs
 		}
 
-		// Set CAInjected if the reconciler has not exited early.
-		r.wasCAInjected.Store(true)
+		// Set reconciled if the reconciler has not exited early.
+		r.webhookStatuses.setReconciled()
+
+		// Retry webhooks whose kind is not served yet, e.g. because their CRD is installed later.
+		if errs.hasState(KindNotServed) {
+			return reconcile.Result{RequeueAfter: unservedWebhookRetryInterval}, nil
+		}
 	}
 
 	return reconcile.Result{}, nil
 }
 
-// ensureCerts returns an arbitrary error if multiple errors are encountered,
-// while all the errors are logged.
-// This is important to allow the controller to reconcile the secret. If an error
-// is returned, request will be requeued, and the controller will attempt to reconcile
-// the secret again.
-// When an error is encountered for when processing a webhook, the error is logged, but
-// following webhooks are also attempted to be updated. If multiple errors occur for different
-// webhooks, only the last one will be returned. This is ok, as the returned error is only meant
-// to indicate that reconciliation failed. The information about all the errors is passed not
-// by the returned error, but rather in the logged errors.
-func (r *ReconcileWH) ensureCerts(certPem []byte) error {
-	var anyError error = nil
-
+// updateWebhookServices updates the Services referenced by the webhooks. Webhooks that
+// cannot be read are skipped, as their errors are reported when injecting them, and their
+// Services are kept until they are read.
+func (r *ReconcileWH) updateWebhookServices() {
+	var webhookServices []types.NamespacedName
+	complete := true
 	for _, webhook := range r.webhooks {
-		gvk := webhook.gvk()
-		log := crLog.WithValues("name", webhook.Name, "gvk", gvk)
-		updatedResource := &unstructured.Unstructured{}
-		updatedResource.SetGroupVersionKind(gvk)
-		if err := r.cache.Get(r.ctx, types.NamespacedName{Name: webhook.Name}, updatedResource); err != nil {
-			if k8sErrors.IsNotFound(err) {
-				log.Error(err, "Webhook not found. Unable to update certificate.")
-				continue
-			}
-			anyError = err
-			log.Error(err, "Error getting webhook for certificate update.")
+		target, err := webhook.target()
+		if err != nil || len(target.servicePaths) == 0 {
 			continue
 		}
-		if !updatedResource.GetDeletionTimestamp().IsZero() {
-			log.Info("Webhook is being deleted. Unable to update certificate")
+		cluster := r.clusterOf(webhook)
+		gvk, err := target.resolveGVK(cluster.mapper)
+		if err != nil {
+			// A webhook whose kind is not served does not reference any Service yet.
+			complete = complete && meta.IsNoMatchError(err)
 			continue
 		}
-
-		log.Info("Ensuring CA cert", "name", webhook.Name, "gvk", gvk)
-		if err := injectCert(updatedResource, certPem, webhook.Type); err != nil {
-			log.Error(err, "Unable to inject cert to webhook.")
-			anyError = err
+		resource := &unstructured.Unstructured{}
+		resource.SetGroupVersionKind(gvk)
+		if err := cluster.reader.Get(r.ctx, webhook.key(r.secretKey.Namespace), resource); err != nil {
+			complete = complete && k8sErrors.IsNotFound(err)
 			continue
 		}
-		opts := []client.UpdateOption{}
-		if r.fieldOwner != "" {
-			opts = append(opts, client.FieldOwner(r.fieldOwner))
+		webhookServices = append(webhookServices, services(resource, target)...)
+	}
+	if r.webhookServices.set(webhookServices, complete) {
+		crLog.Info("services of the webhooks changed", "services", r.webhookServices.list())
+	}
+}
+
+// ensureCerts attempts to inject the CA cert into every webhook, and returns the
+// errors of all webhooks that could not be injected, while all the errors are logged
+// and recorded in the status of their webhook.
+// When an error is encountered for a webhook, following webhooks are also attempted
+// to be updated, so that a failure for one webhook does not mask the others.
+func (r *ReconcileWH) ensureCerts(certPem []byte) WebhookErrors {
+	var errs WebhookErrors
+	r.webhookStatuses.setCA(certPem)
+	for i, webhook := range r.webhooks {
+		state, err := r.ensureCert(i, webhook, certPem)
+		r.webhookStatuses.set(i, state, err)
+		if err != nil {
+			errs = append(errs, &WebhookError{Webhook: webhook, State: state, Err: err})
 		}
-		if err := r.writer.Update(r.ctx, updatedResource, opts...); err != nil {
-			log.Error(err, "Error updating webhook with certificate")
-			anyError = err
-			continue
+	}
+	return errs
+}
+
+// ensureCert injects the CA cert into the webhook at index i of r.webhooks.
+func (r *ReconcileWH) ensureCert(i int, webhook WebhookInfo, certPem []byte) (InjectionState, error) {
+	target, err := webhook.target()
+	if err != nil {
+		crLog.Error(err, "Invalid webhook.", "name", webhook.Name)
+		return InjectionFailed, err
+	}
+	cluster := r.clusterOf(webhook)
+	gvk, err := target.resolveGVK(cluster.mapper)
+	if meta.IsNoMatchError(err) {
+		crLog.Error(err, "Webhook kind is not served. Unable to update certificate.", "name", webhook.Name)
+		return KindNotServed, err
+	}
+	if err != nil {
+		crLog.Error(err, "Error resolving webhook kind for certificate update.", "name", webhook.Name)
+		return InjectionFailed, err
+	}
+	log := crLog.WithValues("name", webhook.Name, "gvk", gvk)
+	if webhook.Cluster != "" {
+		log = log.WithValues("cluster", webhook.Cluster)
+	}
+	if err := r.startPendingWatch(i, gvk); err != nil {
+		log.Error(err, "Error watching webhook.")
+		return InjectionFailed, err
+	}
+	updatedResource := &unstructured.Unstructured{}
+	updatedResource.SetGroupVersionKind(gvk)
+	if err := cluster.reader.Get(r.ctx, webhook.key(r.secretKey.Namespace), updatedResource); err != nil {
+		if k8sErrors.IsNotFound(err) {
+			log.Error(err, "Webhook not found. Unable to update certificate.")
+			return WebhookNotFound, err
 		}
+		log.Error(err, "Error getting webhook for certificate update.")
+		return InjectionFailed, err
+	}
+	if !updatedResource.GetDeletionTimestamp().IsZero() {
+		log.Info("Webhook is being deleted. Unable to update certificate")
+		return WebhookDeleting, errors.New("webhook is being deleted")
+	}
+
+	if caBundleMatches(updatedResource, certPem, target) {
+		log.V(1).Info("CA cert is already injected")
+		r.webhookStatuses.verified(i)
+		return Injected, nil
+	}
+	// The CA bundle was changed since the current CA cert was injected. The drift is recorded
+	// before it is corrected, and reported until the webhook is verified again.
+	drifted := r.webhookStatuses.injected(i)
+	if drifted {
+		log.Info("CA bundle differs from the injected CA cert")
+		r.webhookStatuses.drifted(i)
+	}
+
+	log.Info("Ensuring CA cert", "name", webhook.Name, "gvk", gvk)
+	if err := injectCert(updatedResource, certPem, target); err != nil {
+		log.Error(err, "Unable to inject cert to webhook.")
+		return InjectionFailed, err
+	}
+	opts := []client.UpdateOption{}
+	if r.fieldOwner != "" {
+		opts = append(opts, client.FieldOwner(r.fieldOwner))
 	}
-	return anyError
+	if err := cluster.writer.Update(r.ctx, updatedResource, opts...); err != nil {
+		log.Error(err, "Error updating webhook with certificate")
+		return InjectionFailed, err
+	}
+	if drifted {
+		log.Info("Corrected drifted CA bundle")
+	}
+	return Injected, nil
 }
 
 // ensureCertsMounted ensure the cert files exist.
@@ -897,11 +1418,13 @@ func (cr *CertRotator) ensureCertsMounted() {
 	close(cr.certsMounted)
 }
 
-// ensureReady ensure the cert files exist and the CAs are injected.
-func (cr *CertRotator) ensureReady() {
+// ensureReady ensure the cert files exist and the CAs are injected. When RequireAllWebhooksInjected
+// is set, IsReady is kept open for as long as required webhooks wait for their kind to be served,
+// instead of failing the rotator once the retries are exhausted.
+func (cr *CertRotator) ensureReady(ctx context.Context) {
 	<-cr.certsMounted
 	checkFn := func() (bool, error) {
-		return cr.wasCAInjected.Load(), nil
+		return cr.webhookStatuses.ready(cr.RequireAllWebhooksInjected), nil
 	}
 	if err := wait.ExponentialBackoff(wait.Backoff{
 		Duration: 1 * time.Second,
@@ -909,10 +1432,36 @@ func (cr *CertRotator) ensureReady() {
 		Jitter:   1,
 		Steps:    10,
 	}, checkFn); err != nil {
-		crLog.Error(err, "max retries for checking CA injection")
-		close(cr.caNotInjected)
-		return
+		if !cr.RequireAllWebhooksInjected || !cr.webhookStatuses.waitingForKinds() {
+			crLog.Error(err, "max retries for checking CA injection")
+			close(cr.caNotInjected)
+			return
+		}
+		crLog.Info("waiting for the kinds of required webhooks to be served", "pending", pendingNames(cr.PendingWebhooks()))
+		if err := wait.PollUntilContextCancel(ctx, unservedWebhookRetryInterval, false, func(context.Context) (bool, error) {
+			return checkFn()
+		}); err != nil {
+			return
+		}
+	}
+	if pending := cr.PendingWebhooks(); len(pending) > 0 {
+		crLog.Info("CA certs are injected to webhooks, except for webhooks whose kind is not served yet", "pending", pendingNames(pending))
+	} else {
+		crLog.Info("CA certs are injected to webhooks")
+	}
+	cr.markReady()
+}
+
+// pendingNames returns the names of the pending webhooks.
+func pendingNames(pending []WebhookInfo) []string {
+	names := make([]string, 0, len(pending))
+	for _, webhook := range pending {
+		names = append(names, webhook.Name)
 	}
-	crLog.Info("CA certs are injected to webhooks")
-	close(cr.IsReady)
+	return names
+}
+
+// markReady closes IsReady, which may be closed by either the leader or the replicaRotator.
+func (cr *CertRotator) markReady() {
+	cr.readyOnce.Do(func() { close(cr.IsReady) })
 }
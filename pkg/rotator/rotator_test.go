@@ -1,10 +1,12 @@
 package rotator
 
 import (
+	"bytes"
 	"context"
 	"crypto/x509"
 	"fmt"
 	"reflect"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -13,13 +15,18 @@ import (
 	admissionv1 "k8s.io/api/admissionregistration/v1"
 	corev1 "k8s.io/api/core/v1"
 	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/rest"
 	"k8s.io/client-go/util/retry"
 	apiregistrationv1 "k8s.io/kube-aggregator/pkg/apis/apiregistration/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/metrics/server"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
@@ -162,7 +169,7 @@ func TestSecretRoundTrip(t *testing.T) {
 	}
 
 	secret := &corev1.Secret{}
-	populateSecret(cert, key, cr.CertName, cr.KeyName, caArtifacts, secret)
+	populateSecret(cert, key, cr.CertName, cr.KeyName, caArtifacts, nil, secret)
 	art2, err := buildArtifactsFromSecret(secret)
 	if err != nil {
 		t.Fatal(err)
@@ -182,6 +189,110 @@ func TestSecretRoundTrip(t *testing.T) {
 	}
 }
 
+// newTestRotator returns a rotator of the secret ns/secret with the defaults of AddRotator,
+// reading and writing through a fake client that holds the empty secret and the objects.
+func newTestRotator(t *testing.T, objs ...client.Object) (*CertRotator, client.Client) {
+	t.Helper()
+	key := types.NamespacedName{Namespace: "ns", Name: "secret"}
+	objs = append([]client.Object{&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: key.Namespace, Name: key.Name},
+	}}, objs...)
+	c := fake.NewClientBuilder().WithObjects(objs...).Build()
+	return &CertRotator{
+		SecretKey:          key,
+		CAName:             "ca",
+		CAOrganization:     "org",
+		DNSName:            "service.namespace",
+		CertName:           defaultCertName,
+		KeyName:            defaultKeyName,
+		CaCertDuration:     defaultCaCertValidityDuration,
+		ServerCertDuration: defaultServerCertValidityDuration,
+		ExtKeyUsages:       &[]x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		apiReader:          c,
+		writer:             c,
+	}, c
+}
+
+// refreshSecrets refreshes the certs of the rotator, and returns its secret followed by the
+// secrets of the keys, along with whether the CA was rotated.
+func refreshSecrets(t *testing.T, rotator *CertRotator, keys ...types.NamespacedName) ([]*corev1.Secret, bool) {
+	t.Helper()
+	rotatedCA, err := rotator.refreshCertIfNeeded()
+	if err != nil {
+		t.Fatal(err)
+	}
+	secrets := make([]*corev1.Secret, 0, len(keys)+1)
+	for _, key := range append([]types.NamespacedName{rotator.SecretKey}, keys...) {
+		secret := &corev1.Secret{}
+		if err := rotator.apiReader.Get(context.Background(), key, secret); err != nil {
+			t.Fatal(err)
+		}
+		secrets = append(secrets, secret)
+	}
+	return secrets, rotatedCA
+}
+
+// refreshSecret refreshes the certs of the rotator, and returns its secret.
+func refreshSecret(t *testing.T, rotator *CertRotator) *corev1.Secret {
+	t.Helper()
+	secrets, _ := refreshSecrets(t, rotator)
+	return secrets[0]
+}
+
+// concurrentWriter rotates the certs of the secret on behalf of another replica
+// before the first update made through it.
+type concurrentWriter struct {
+	client.Client
+	rotate func() error
+}
+
+func (w *concurrentWriter) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+	if w.rotate != nil {
+		rotate := w.rotate
+		w.rotate = nil
+		if err := rotate(); err != nil {
+			return err
+		}
+	}
+	return w.Client.Update(ctx, obj, opts...)
+}
+
+// Verifies that a CA rotated by another replica is not rotated again.
+func TestRefreshCertConflict(t *testing.T) {
+	rotator, c := newTestRotator(t)
+	// The other replica reads and writes the same secret.
+	other, _ := newTestRotator(t)
+	other.apiReader, other.writer = c, c
+
+	var otherCA []byte
+	rotator.writer = &concurrentWriter{Client: c, rotate: func() error {
+		secret := &corev1.Secret{}
+		if err := c.Get(context.Background(), rotator.SecretKey, secret); err != nil {
+			return err
+		}
+		if err := other.refreshCerts(true, secret, secret); err != nil {
+			return err
+		}
+		otherCA = secret.Data[caCertName]
+		return nil
+	}}
+
+	rotatedCA, err := rotator.refreshCertIfNeeded()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rotatedCA {
+		t.Error("expected the CA rotated by the other replica not to be rotated again")
+	}
+	secret := &corev1.Secret{}
+	if err := c.Get(context.Background(), rotator.SecretKey, secret); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(secret.Data[caCertName], otherCA) {
+		t.Error("expected the secret to hold the CA of the other replica")
+	}
+}
+
 func TestEmptyIsInvalid(t *testing.T) {
 	if cr.validServerCert([]byte{}, []byte{}, []byte{}) {
 		t.Fatal("empty cert is valid")
@@ -191,6 +302,67 @@ func TestEmptyIsInvalid(t *testing.T) {
 	}
 }
 
+func TestCachedObjects(t *testing.T) {
+	g := gomega.NewWithT(t)
+	mapper := meta.NewDefaultRESTMapper([]schema.GroupVersion{
+		corev1.SchemeGroupVersion,
+		admissionv1.SchemeGroupVersion,
+		apiextensionsv1.SchemeGroupVersion,
+	})
+	mapper.Add(corev1.SchemeGroupVersion.WithKind("Secret"), meta.RESTScopeNamespace)
+	mapper.Add(corev1.SchemeGroupVersion.WithKind("ConfigMap"), meta.RESTScopeNamespace)
+	mapper.Add(admissionv1.SchemeGroupVersion.WithKind("ValidatingWebhookConfiguration"), meta.RESTScopeRoot)
+	mapper.Add(apiextensionsv1.SchemeGroupVersion.WithKind("CustomResourceDefinition"), meta.RESTScopeRoot)
+
+	rotator := &CertRotator{
+		SecretKey: types.NamespacedName{Namespace: "ns", Name: "secret"},
+		Webhooks: []WebhookInfo{
+			{Name: "vwh-1", Type: Validating},
+			{Name: "vwh-2", Type: Validating},
+			{Name: "crd", Type: CRDConversion},
+			{Name: "ca", Type: ConfigMap},
+			{Name: "ca", Namespace: "other", Type: ConfigMap},
+			{Name: "provider", Type: ExternalDataProvider},
+			{Name: "guest-vwh", Type: Validating, Cluster: "guest"},
+		},
+	}
+	selectors := func(cluster string) map[string]string {
+		objs, err := cachedObjects(rotator, cluster, "ns", mapper)
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+
+		// Every object is cached on its own, restricted to its name.
+		selectors := make(map[string]string)
+		for _, obj := range objs {
+			opts := objectCacheOptions(runtime.NewScheme(), mapper, obj.obj, obj.key)
+			g.Expect(opts.ByObject).To(gomega.HaveLen(1))
+			g.Expect(opts.DefaultNamespaces).To(gomega.BeNil())
+			kind := obj.obj.GetObjectKind().GroupVersionKind().Kind
+			if _, ok := obj.obj.(*corev1.Secret); ok {
+				kind = "Secret"
+			}
+			config := opts.ByObject[obj.obj]
+			if config.Namespaces == nil {
+				selectors[kind+" "+obj.key.String()] = fmt.Sprint(config.Field)
+				continue
+			}
+			g.Expect(config.Namespaces).To(gomega.HaveLen(1))
+			selectors[kind+" "+obj.key.String()] = fmt.Sprint(config.Namespaces[obj.key.Namespace].FieldSelector)
+		}
+		return selectors
+	}
+	g.Expect(selectors("")).To(gomega.Equal(map[string]string{
+		"Secret ns/secret":                      "metadata.name=secret",
+		"ValidatingWebhookConfiguration /vwh-1": "metadata.name=vwh-1",
+		"ValidatingWebhookConfiguration /vwh-2": "metadata.name=vwh-2",
+		"CustomResourceDefinition /crd":         "metadata.name=crd",
+		"ConfigMap ns/ca":                       "metadata.name=ca",
+		"ConfigMap other/ca":                    "metadata.name=ca",
+	}))
+	g.Expect(selectors("guest")).To(gomega.Equal(map[string]string{
+		"ValidatingWebhookConfiguration /guest-vwh": "metadata.name=guest-vwh",
+	}))
+}
+
 func setupManager(g *gomega.GomegaWithT) manager.Manager {
 	disabledMetrics := "0"
 
@@ -247,6 +419,14 @@ func testWebhook(t *testing.T, secretKey types.NamespacedName, rotator *CertRota
 	// Verify certificates are regenerated
 	ensureWebhookPopulated(ctx, g, c, wh, webhooksField, caBundleField, fieldOwner)
 
+	// Verify the reset was corrected as drift
+	g.Eventually(func() int {
+		return rotator.WebhookStatuses()[0].DriftCorrections
+	}, gEventuallyTimeout, gEventuallyInterval).Should(gomega.BeNumerically(">=", 1), "waiting for drift correction")
+	g.Eventually(func() bool {
+		return rotator.WebhookStatuses()[0].Degraded
+	}, gEventuallyTimeout, gEventuallyInterval).Should(gomega.BeFalse(), "waiting for the corrected webhook to be verified")
+
 	cancelFunc()
 	wg.Wait()
 }
@@ -351,6 +531,7 @@ func TestReconcileWebhook(t *testing.T) {
 				},
 			},
 		},
+		{"configmap", ConfigMap, nil, []string{"data", "ca.crt"}, &corev1.ConfigMap{}},
 	}
 
 	for _, tt := range testCases {
@@ -388,6 +569,9 @@ func TestReconcileWebhook(t *testing.T) {
 				t.Fatalf("could not deep copy wh object")
 			}
 			wh.SetName(whName)
+			if builtinTargets[tt.webhookType].namespaced {
+				wh.SetNamespace(nsName)
+			}
 
 			testWebhook(t, key, rotator, wh, tt.webhooksField, tt.caBundleField, fieldOwner)
 		})
@@ -421,12 +605,219 @@ func TestReconcileWebhook(t *testing.T) {
 				t.Fatalf("could not deep copy wh object")
 			}
 			wh.SetName(whName)
+			if builtinTargets[tt.webhookType].namespaced {
+				wh.SetNamespace(nsName)
+			}
 
 			testWebhook(t, key, rotator, wh, tt.webhooksField, tt.caBundleField, "")
 		})
 	}
 }
 
+// TestNamespacedWebhook makes sure that namespaced resources outside of the namespace of the secret are injected.
+func TestNamespacedWebhook(t *testing.T) {
+	g := gomega.NewWithT(t)
+	key := types.NamespacedName{Namespace: "test-namespaced-webhook", Name: "test-secret"}
+	whKey := types.NamespacedName{Namespace: "test-namespaced-webhook-target", Name: "test-ca"}
+
+	c, err := client.New(cfg, client.Options{})
+	g.Expect(err).NotTo(gomega.HaveOccurred(), "creating client")
+	err = c.Create(context.Background(), &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{Name: whKey.Namespace},
+	})
+	g.Expect(err).NotTo(gomega.HaveOccurred(), "creating namespace", whKey.Namespace)
+
+	rotator := &CertRotator{
+		SecretKey: key,
+		Webhooks: []WebhookInfo{
+			{
+				Name:      whKey.Name,
+				Namespace: whKey.Namespace,
+				Type:      ConfigMap,
+			},
+		},
+		ControllerName: t.Name(),
+	}
+	wh := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: whKey.Namespace, Name: whKey.Name},
+	}
+
+	testWebhook(t, key, rotator, wh, nil, []string{"data", "ca.crt"}, "")
+}
+
+// TestLateWebhookKind makes sure that webhooks whose CRD is installed after the rotator started are watched and injected.
+func TestLateWebhookKind(t *testing.T) {
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	defer cancelFunc()
+
+	g := gomega.NewWithT(t)
+	mgr := setupManager(g)
+	c := mgr.GetClient()
+
+	key := types.NamespacedName{Namespace: "test-late-webhook-kind", Name: "test-secret"}
+	gvk := schema.GroupVersionKind{Group: "late.example.com", Version: "v1", Kind: "Widget"}
+	rotator := &CertRotator{
+		SecretKey: key,
+		Webhooks: []WebhookInfo{
+			{
+				Name:       "test-widget",
+				Type:       Generic,
+				GVK:        schema.GroupVersionKind{Group: gvk.Group, Kind: gvk.Kind},
+				FieldPaths: []string{"spec.caBundle"},
+			},
+		},
+		ControllerName: t.Name(),
+	}
+	err := AddRotator(mgr, rotator)
+	g.Expect(err).NotTo(gomega.HaveOccurred(), "adding rotator")
+	g.Expect(rotator.PendingWebhooks()).To(gomega.HaveLen(1), "expected webhook to be pending")
+
+	createSecret(ctx, g, c, key)
+	wg := StartTestManager(ctx, mgr, g)
+	ensureCertWasGenerated(ctx, g, c, key)
+
+	preserveUnknownFields := true
+	crd := &apiextensionsv1.CustomResourceDefinition{
+		ObjectMeta: metav1.ObjectMeta{Name: "widgets.late.example.com"},
+		Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+			Group: gvk.Group,
+			Scope: apiextensionsv1.ClusterScoped,
+			Names: apiextensionsv1.CustomResourceDefinitionNames{
+				Kind:     gvk.Kind,
+				ListKind: gvk.Kind + "List",
+				Plural:   "widgets",
+				Singular: "widget",
+			},
+			Versions: []apiextensionsv1.CustomResourceDefinitionVersion{
+				{
+					Name:    gvk.Version,
+					Served:  true,
+					Storage: true,
+					Schema: &apiextensionsv1.CustomResourceValidation{
+						OpenAPIV3Schema: &apiextensionsv1.JSONSchemaProps{
+							Type:                   "object",
+							XPreserveUnknownFields: &preserveUnknownFields,
+						},
+					},
+				},
+			},
+		},
+	}
+	err = c.Create(ctx, crd)
+	g.Expect(err).NotTo(gomega.HaveOccurred(), "creating CRD")
+
+	wh := &unstructured.Unstructured{}
+	wh.SetGroupVersionKind(gvk)
+	wh.SetName("test-widget")
+	err = unstructured.SetNestedField(wh.Object, "", "spec", "caBundle")
+	g.Expect(err).NotTo(gomega.HaveOccurred(), "setting caBundle")
+	g.Eventually(func() error {
+		return c.Create(ctx, wh)
+	}, gEventuallyTimeout, gEventuallyInterval).Should(gomega.Succeed(), "creating widget")
+
+	// Trigger a reconcile instead of waiting for the retry of unserved webhooks.
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		secret := &corev1.Secret{}
+		if err := c.Get(ctx, key, secret); err != nil {
+			return err
+		}
+		secret.Annotations = map[string]string{"test-annon": time.Now().GoString()}
+		return c.Update(ctx, secret)
+	})
+	g.Expect(err).NotTo(gomega.HaveOccurred(), "updating secret")
+
+	g.Eventually(func() bool {
+		if err := c.Get(ctx, client.ObjectKeyFromObject(wh), wh); err != nil {
+			return false
+		}
+		caBundle, _, _ := unstructured.NestedString(wh.Object, "spec", "caBundle")
+		return caBundle != ""
+	}, gEventuallyTimeout, gEventuallyInterval).Should(gomega.BeTrue(), "waiting for widget to be injected")
+	g.Expect(rotator.PendingWebhooks()).To(gomega.BeEmpty(), "expected webhook to be watched")
+
+	cancelFunc()
+	wg.Wait()
+}
+
+// TestReconcileWebhookStatuses makes sure that the status of every webhook is reported.
+func TestReconcileWebhookStatuses(t *testing.T) {
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	defer cancelFunc()
+
+	g := gomega.NewWithT(t)
+	mgr := setupManager(g)
+	c := mgr.GetClient()
+
+	key := types.NamespacedName{Namespace: "test-reconcile-webhook-statuses", Name: "test-secret"}
+	rotator := &CertRotator{
+		SecretKey: key,
+		Webhooks: []WebhookInfo{
+			{Name: "test-webhook-statuses-missing", Type: Validating},
+			{Name: "test-webhook-statuses", Type: Validating},
+		},
+		ControllerName: t.Name(),
+	}
+	err := AddRotator(mgr, rotator)
+	g.Expect(err).NotTo(gomega.HaveOccurred(), "adding rotator")
+
+	createSecret(ctx, g, c, key)
+	wh := &admissionv1.ValidatingWebhookConfiguration{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-webhook-statuses"},
+		Webhooks: []admissionv1.ValidatingWebhook{
+			{
+				Name:        "testpolicy.kubernetes.io",
+				SideEffects: &sideEffectNone,
+				ClientConfig: admissionv1.WebhookClientConfig{
+					URL: strPtr("https://localhost/webhook"),
+				},
+				AdmissionReviewVersions: []string{"v1", "v1beta1"},
+			},
+		},
+	}
+	err = c.Create(ctx, wh)
+	g.Expect(err).NotTo(gomega.HaveOccurred(), "creating webhookConfig")
+
+	wg := StartTestManager(ctx, mgr, g)
+
+	g.Eventually(func() []InjectionState {
+		var states []InjectionState
+		for _, status := range rotator.WebhookStatuses() {
+			states = append(states, status.State)
+		}
+		return states
+	}, gEventuallyTimeout, gEventuallyInterval).Should(gomega.Equal([]InjectionState{WebhookNotFound, Injected}), "waiting for webhook statuses")
+
+	statuses := rotator.WebhookStatuses()
+	g.Expect(k8sErrors.IsNotFound(statuses[0].Err)).To(gomega.BeTrue(), "expected NotFound error")
+	g.Expect(statuses[1].Err).To(gomega.BeNil())
+	g.Expect(statuses[1].Current).To(gomega.BeTrue(), "expected webhook to carry the current CA")
+	g.Expect(rotator.CheckWebhooks(nil)).To(gomega.MatchError(gomega.ContainSubstring("test-webhook-statuses-missing")))
+
+	// Reconciling again does not update a webhook that already carries the current CA.
+	err = c.Get(ctx, client.ObjectKeyFromObject(wh), wh)
+	g.Expect(err).NotTo(gomega.HaveOccurred(), "getting webhookConfig")
+	resourceVersion := wh.ResourceVersion
+	lastReconcile := statuses[1].LastReconcileTime
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		secret := &corev1.Secret{}
+		if err := c.Get(ctx, key, secret); err != nil {
+			return err
+		}
+		secret.Annotations = map[string]string{"test-annon": time.Now().GoString()}
+		return c.Update(ctx, secret)
+	})
+	g.Expect(err).NotTo(gomega.HaveOccurred(), "updating secret")
+	g.Eventually(func() bool {
+		return rotator.WebhookStatuses()[1].LastReconcileTime.After(lastReconcile)
+	}, gEventuallyTimeout, gEventuallyInterval).Should(gomega.BeTrue(), "waiting for webhook reconciliation")
+	err = c.Get(ctx, client.ObjectKeyFromObject(wh), wh)
+	g.Expect(err).NotTo(gomega.HaveOccurred(), "getting webhookConfig")
+	g.Expect(wh.ResourceVersion).To(gomega.Equal(resourceVersion), "expected webhookConfig not to be updated")
+
+	cancelFunc()
+	wg.Wait()
+}
+
 // TestWebhookCARotation makes sure that a webhook will be able to regenerate/ rotate the CA.
 func TestWebhookCARotation(t *testing.T) {
 	whName := "test-webhook-validating"
@@ -569,6 +960,114 @@ func TestNamespacedCache(t *testing.T) {
 	wg.Wait()
 }
 
+// Verifies that webhooks of a target cluster are injected through its own cache and client.
+// The target cluster is the test cluster itself, accessed through its own config.
+func TestTargetCluster(t *testing.T) {
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	defer cancelFunc()
+	g := gomega.NewWithT(t)
+	mgr := setupManager(g)
+	c := mgr.GetClient()
+
+	key := types.NamespacedName{Namespace: "test-target-cluster", Name: "test-secret"}
+	wh := &admissionv1.ValidatingWebhookConfiguration{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-target-cluster"},
+		Webhooks: []admissionv1.ValidatingWebhook{
+			{
+				Name:        "testpolicy.kubernetes.io",
+				SideEffects: &sideEffectNone,
+				ClientConfig: admissionv1.WebhookClientConfig{
+					URL: strPtr("https://localhost/webhook"),
+				},
+				AdmissionReviewVersions: []string{"v1", "v1beta1"},
+			},
+		},
+	}
+	rotator := &CertRotator{
+		SecretKey: key,
+		Webhooks: []WebhookInfo{
+			{Name: wh.Name, Type: Validating, Cluster: "guest"},
+		},
+		TargetClusters: map[string]*rest.Config{"guest": rest.CopyConfig(cfg)},
+		ControllerName: t.Name(),
+	}
+
+	err := AddRotator(mgr, &CertRotator{
+		SecretKey:      key,
+		Webhooks:       []WebhookInfo{{Name: wh.Name, Type: Validating, Cluster: "unknown"}},
+		ControllerName: t.Name(),
+	})
+	g.Expect(err).To(gomega.HaveOccurred(), "adding rotator with an unknown target cluster")
+
+	err = AddRotator(mgr, rotator)
+	g.Expect(err).NotTo(gomega.HaveOccurred(), "adding rotator")
+
+	createSecret(ctx, g, c, key)
+	err = c.Create(ctx, wh)
+	g.Expect(err).NotTo(gomega.HaveOccurred(), "creating webhookConfig")
+
+	wg := StartTestManager(ctx, mgr, g)
+
+	ensureCertWasGenerated(ctx, g, c, key)
+	ensureWebhookPopulated(ctx, g, c, wh, []string{"webhooks"}, []string{"clientConfig", "caBundle"}, "")
+
+	cancelFunc()
+	wg.Wait()
+}
+
+// countingWriter counts the updates made through it.
+type countingWriter struct {
+	client.Writer
+	updates atomic.Int32
+}
+
+func (w *countingWriter) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+	w.updates.Add(1)
+	return w.Writer.Update(ctx, obj, opts...)
+}
+
+// Verifies that the rotator reads and writes through the provided Reader and Writer.
+func TestCustomReaderWriter(t *testing.T) {
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	defer cancelFunc()
+	g := gomega.NewWithT(t)
+	mgr := setupManager(g)
+	c := mgr.GetClient()
+
+	key := types.NamespacedName{Namespace: "test-custom-reader-writer", Name: "test-secret"}
+	writer := &countingWriter{Writer: c}
+	rotator := &CertRotator{
+		SecretKey: key,
+		Webhooks: []WebhookInfo{
+			{Name: "test-ca", Type: ConfigMap},
+		},
+		Reader:         mgr.GetCache(),
+		Writer:         writer,
+		ControllerName: t.Name(),
+	}
+	err := AddRotator(mgr, rotator)
+	g.Expect(err).NotTo(gomega.HaveOccurred(), "adding rotator")
+	g.Expect(rotator.reader).To(gomega.Equal(mgr.GetCache()), "using the provided reader")
+
+	createSecret(ctx, g, c, key)
+	wh := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: key.Namespace, Name: "test-ca"},
+	}
+	err = c.Create(ctx, wh)
+	g.Expect(err).NotTo(gomega.HaveOccurred(), "creating configmap")
+
+	wg := StartTestManager(ctx, mgr, g)
+
+	ensureCertWasGenerated(ctx, g, c, key)
+	ensureWebhookPopulated(ctx, g, c, wh, nil, []string{"data", "ca.crt"}, "")
+
+	// The secret and the configmap were both updated through the writer.
+	g.Expect(writer.updates.Load()).To(gomega.BeNumerically(">=", 2), "counting updates")
+
+	cancelFunc()
+	wg.Wait()
+}
+
 func ensureCertWasGenerated(ctx context.Context, g *gomega.WithT, c client.Reader, key types.NamespacedName) {
 	var secret corev1.Secret
 	g.Eventually(func() bool {
@@ -0,0 +1,39 @@
+package rotator
+
+import (
+	"fmt"
+	"net"
+	"net/mail"
+	"net/url"
+)
+
+// validateSANs returns an error if a subject alternative name of the server cert is malformed.
+func (cr *CertRotator) validateSANs() error {
+	return validateSANs(cr.IPAddresses, cr.URIs, cr.EmailAddresses, cr.CANameConstraints)
+}
+
+// validateSANs returns an error if an IP address, URI or email address is malformed. URIs must
+// have a host under name constraints, as the CA permits the hosts of the URIs, and URIs without
+// one, e.g. URNs, are rejected by any URI constraint.
+func validateSANs(ipAddresses []net.IP, uris []*url.URL, emailAddresses []string, nameConstraints bool) error {
+	for i, ip := range ipAddresses {
+		if len(ip) != 4 && len(ip) != 16 {
+			return fmt.Errorf("invalid IP address %d: %v", i, ip)
+		}
+	}
+	for i, uri := range uris {
+		if uri == nil || !uri.IsAbs() {
+			return fmt.Errorf("invalid URI %d: %v, an absolute URI is required", i, uri)
+		}
+		if nameConstraints && uri.Hostname() == "" {
+			return fmt.Errorf("invalid URI %d: %v, a URI with a host is required by CA name constraints", i, uri)
+		}
+	}
+	for _, email := range emailAddresses {
+		addr, err := mail.ParseAddress(email)
+		if err != nil || addr.Address != email {
+			return fmt.Errorf("invalid email address %q", email)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package rotator
+
+import (
+	"net"
+	"net/url"
+	"testing"
+)
+
+func TestValidateSANs(t *testing.T) {
+	spiffe, _ := url.Parse("spiffe://cluster.local/ns/ns/sa/webhook")
+	relative, _ := url.Parse("/ns/ns/sa/webhook")
+	urn, _ := url.Parse("urn:example:webhook")
+	testCases := []struct {
+		name    string
+		rotator *CertRotator
+		wantErr bool
+	}{
+		{name: "valid", rotator: &CertRotator{IPAddresses: []net.IP{net.ParseIP("10.0.0.1")}, URIs: []*url.URL{spiffe}, EmailAddresses: []string{"admin@example.com"}}},
+		{name: "invalid IP", rotator: &CertRotator{IPAddresses: []net.IP{net.ParseIP("10.0.0")}}, wantErr: true},
+		{name: "relative URI", rotator: &CertRotator{URIs: []*url.URL{relative}}, wantErr: true},
+		{name: "nil URI", rotator: &CertRotator{URIs: []*url.URL{nil}}, wantErr: true},
+		{name: "URI without host", rotator: &CertRotator{URIs: []*url.URL{urn}}},
+		{name: "URI without host under name constraints", rotator: &CertRotator{URIs: []*url.URL{urn}, CANameConstraints: true}, wantErr: true},
+		{name: "URI under name constraints", rotator: &CertRotator{URIs: []*url.URL{spiffe}, CANameConstraints: true}},
+		{name: "invalid email", rotator: &CertRotator{EmailAddresses: []string{"Admin <admin@example.com>"}}, wantErr: true},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.rotator.validateSANs()
+			if tt.wantErr != (err != nil) {
+				t.Errorf("got error %v, want error: %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// Verifies that the server cert is re-issued when its IP, URI or email SANs change.
+func TestServerCertSANs(t *testing.T) {
+	spiffe, _ := url.Parse("spiffe://cluster.local/ns/ns/sa/webhook")
+	rotator := &CertRotator{
+		CAName:         "ca",
+		CAOrganization: "org",
+		DNSName:        "service.namespace",
+		IPAddresses:    []net.IP{net.ParseIP("10.0.0.1"), net.ParseIP("fd00::1")},
+		URIs:           []*url.URL{spiffe},
+		EmailAddresses: []string{"admin@example.com"},
+		ExtKeyUsages:   cr.ExtKeyUsages,
+	}
+	caArtifacts, err := rotator.CreateCACert(begin, end)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, key, err := rotator.CreateCertPEM(caArtifacts, begin, end)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !rotator.validServerCert(caArtifacts.CertPEM, cert, key) {
+		t.Fatal("expected the server cert to be valid")
+	}
+
+	other, _ := url.Parse("spiffe://cluster.local/ns/ns/sa/other")
+	changes := map[string]func(*CertRotator){
+		"IP":    func(r *CertRotator) { r.IPAddresses = append(r.IPAddresses, net.ParseIP("10.0.0.2")) },
+		"URI":   func(r *CertRotator) { r.URIs = []*url.URL{other} },
+		"email": func(r *CertRotator) { r.EmailAddresses = []string{"other@example.com"} },
+	}
+	for name, change := range changes {
+		t.Run(name, func(t *testing.T) {
+			changed := &CertRotator{
+				DNSName:        rotator.DNSName,
+				IPAddresses:    rotator.IPAddresses,
+				URIs:           rotator.URIs,
+				EmailAddresses: rotator.EmailAddresses,
+				ExtKeyUsages:   rotator.ExtKeyUsages,
+			}
+			change(changed)
+			if changed.validServerCert(caArtifacts.CertPEM, cert, key) {
+				t.Errorf("expected the server cert to be invalid after the %s SANs changed", name)
+			}
+		})
+	}
+}
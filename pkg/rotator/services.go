@@ -0,0 +1,117 @@
+package rotator
+
+import (
+	"sort"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+const defaultClusterDomain = "cluster.local"
+
+// serviceDNSNames returns the DNS names of a Service, from the shortest to the fully qualified one.
+func serviceDNSNames(service types.NamespacedName, clusterDomain string) []string {
+	svc := service.Name + "." + service.Namespace + ".svc"
+	return []string{
+		service.Name,
+		service.Name + "." + service.Namespace,
+		svc,
+		svc + "." + clusterDomain,
+	}
+}
+
+// dnsNames returns the DNS names of the server cert: DNSName, ExtraDNSNames and the DNS names
+// of Services and of the Services referenced by the webhooks, without duplicates.
+func (cr *CertRotator) dnsNames() []string {
+	services := append([]types.NamespacedName(nil), cr.Services...)
+	if cr.webhookServices != nil {
+		services = append(services, cr.webhookServices.list()...)
+	}
+	return dnsNames(cr.ClusterDomain, cr.DNSName, cr.ExtraDNSNames, services)
+}
+
+// partialDNSNames returns true if the Services of the webhooks have not been discovered yet,
+// so that the DNS names of the server cert may lack theirs.
+func (cr *CertRotator) partialDNSNames() bool {
+	return cr.ServicesFromWebhooks && cr.webhookServices != nil && !cr.webhookServices.isDiscovered()
+}
+
+// dnsNames returns the DNS name, the extra DNS names and the DNS names of the Services,
+// without duplicates.
+func dnsNames(clusterDomain, dnsName string, extraDNSNames []string, services []types.NamespacedName) []string {
+	if clusterDomain == "" {
+		clusterDomain = defaultClusterDomain
+	}
+	seen := sets.New[string]()
+	var names []string
+	add := func(name string) {
+		if name != "" && !seen.Has(name) {
+			seen.Insert(name)
+			names = append(names, name)
+		}
+	}
+	add(dnsName)
+	for _, name := range extraDNSNames {
+		add(name)
+	}
+	for _, service := range services {
+		for _, name := range serviceDNSNames(service, clusterDomain) {
+			add(name)
+		}
+	}
+	return names
+}
+
+// webhookServices holds the Services referenced by the webhooks when
+// CertRotator.ServicesFromWebhooks is true.
+type webhookServices struct {
+	mu       sync.RWMutex
+	services sets.Set[types.NamespacedName]
+	// discovered is true once the Services of every webhook have been read.
+	discovered bool
+}
+
+func newWebhookServices() *webhookServices {
+	return &webhookServices{services: sets.New[types.NamespacedName]()}
+}
+
+// set replaces the Services, and returns true if they changed. If some webhooks could not be
+// read, the Services are only added, so that the Services of those webhooks are kept.
+func (s *webhookServices) set(services []types.NamespacedName, complete bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	updated := sets.New(services...)
+	if complete {
+		s.discovered = true
+	} else {
+		updated = updated.Union(s.services)
+	}
+	if updated.Equal(s.services) {
+		return false
+	}
+	s.services = updated
+	return true
+}
+
+// isDiscovered returns true once the Services of every webhook have been read, so that
+// the DNS names of the server cert are complete.
+func (s *webhookServices) isDiscovered() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.discovered
+}
+
+// list returns the Services sorted by namespace and name.
+func (s *webhookServices) list() []types.NamespacedName {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	services := s.services.UnsortedList()
+	sort.Slice(services, func(i, j int) bool {
+		if services[i].Namespace != services[j].Namespace {
+			return services[i].Namespace < services[j].Namespace
+		}
+		return services[i].Name < services[j].Name
+	})
+	return services
+}
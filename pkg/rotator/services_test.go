@@ -0,0 +1,220 @@
+package rotator
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"reflect"
+	"testing"
+
+	admissionv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestDNSNames(t *testing.T) {
+	rotator := &CertRotator{
+		DNSName:       "webhook.ns.svc",
+		ExtraDNSNames: []string{"webhook.example.com"},
+		Services:      []types.NamespacedName{{Namespace: "ns", Name: "webhook"}},
+		ClusterDomain: "example.local",
+	}
+	want := []string{
+		"webhook.ns.svc",
+		"webhook.example.com",
+		"webhook",
+		"webhook.ns",
+		"webhook.ns.svc.example.local",
+	}
+	if got := rotator.dnsNames(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	rotator = &CertRotator{
+		Services:        []types.NamespacedName{{Namespace: "ns", Name: "webhook"}},
+		webhookServices: newWebhookServices(),
+	}
+	if !rotator.webhookServices.set([]types.NamespacedName{{Namespace: "other", Name: "api"}}, true) {
+		t.Error("expected the webhook services to change")
+	}
+	if rotator.webhookServices.set([]types.NamespacedName{{Namespace: "other", Name: "api"}}, true) {
+		t.Error("expected the webhook services not to change")
+	}
+	// The Services of webhooks that could not be read are kept.
+	if rotator.webhookServices.set(nil, false) {
+		t.Error("expected the webhook services to be kept")
+	}
+	want = []string{
+		"webhook",
+		"webhook.ns",
+		"webhook.ns.svc",
+		"webhook.ns.svc.cluster.local",
+		"api",
+		"api.other",
+		"api.other.svc",
+		"api.other.svc.cluster.local",
+	}
+	if got := rotator.dnsNames(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestWebhookServices(t *testing.T) {
+	u := &unstructured.Unstructured{Object: map[string]interface{}{
+		"webhooks": []interface{}{
+			map[string]interface{}{"clientConfig": map[string]interface{}{
+				"service": map[string]interface{}{"namespace": "ns", "name": "webhook"},
+			}},
+			map[string]interface{}{"clientConfig": map[string]interface{}{
+				"url": "https://example.com",
+			}},
+			map[string]interface{}{"clientConfig": map[string]interface{}{
+				"service": map[string]interface{}{"namespace": "other", "name": "webhook"},
+			}},
+		},
+	}}
+	want := []types.NamespacedName{{Namespace: "ns", Name: "webhook"}, {Namespace: "other", Name: "webhook"}}
+	if got := services(u, builtinTargets[Validating]); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	u = &unstructured.Unstructured{Object: map[string]interface{}{
+		"spec": map[string]interface{}{"service": map[string]interface{}{"namespace": "ns", "name": "api"}},
+	}}
+	want = []types.NamespacedName{{Namespace: "ns", Name: "api"}}
+	if got := services(u, builtinTargets[APIService]); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got := services(u, builtinTargets[ExternalDataProvider]); got != nil {
+		t.Errorf("got %v, want no services", got)
+	}
+}
+
+// Verifies that the server cert is re-issued when the DNS names of the Services change.
+func TestServerCertServices(t *testing.T) {
+	rotator := &CertRotator{
+		CAName:          "ca",
+		CAOrganization:  "org",
+		Services:        []types.NamespacedName{{Namespace: "ns", Name: "webhook"}},
+		ExtKeyUsages:    cr.ExtKeyUsages,
+		webhookServices: newWebhookServices(),
+	}
+	caArtifacts, err := rotator.CreateCACert(begin, end)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, key, err := rotator.CreateCertPEM(caArtifacts, begin, end)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !rotator.validServerCert(caArtifacts.CertPEM, cert, key) {
+		t.Fatal("expected the server cert to be valid")
+	}
+
+	rotator.webhookServices.set([]types.NamespacedName{{Namespace: "ns", Name: "renamed"}}, true)
+	if rotator.validServerCert(caArtifacts.CertPEM, cert, key) {
+		t.Error("expected the server cert to be invalid for a new Service")
+	}
+}
+
+// Verifies that a rotator restarted against a valid secret neither re-issues the server cert
+// issued for the Services of the webhooks nor rotates a CA constrained to them.
+func TestRestartWithWebhookServices(t *testing.T) {
+	for _, nameConstraints := range []bool{false, true} {
+		t.Run(fmt.Sprintf("nameConstraints=%t", nameConstraints), func(t *testing.T) {
+			testRestartWithWebhookServices(t, nameConstraints)
+		})
+	}
+}
+
+func testRestartWithWebhookServices(t *testing.T, nameConstraints bool) {
+	ctx := context.Background()
+	key := types.NamespacedName{Namespace: "ns", Name: "secret"}
+	vwc := &admissionv1.ValidatingWebhookConfiguration{
+		ObjectMeta: metav1.ObjectMeta{Name: "vwh"},
+		Webhooks: []admissionv1.ValidatingWebhook{{
+			Name: "vwh.example.com",
+			ClientConfig: admissionv1.WebhookClientConfig{
+				Service: &admissionv1.ServiceReference{Namespace: "ns", Name: "webhook"},
+			},
+		}},
+	}
+	c := fake.NewClientBuilder().WithObjects(
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: key.Namespace, Name: key.Name}},
+		vwc,
+	).Build()
+	mapper := meta.NewDefaultRESTMapper([]schema.GroupVersion{admissionv1.SchemeGroupVersion})
+	mapper.Add(admissionv1.SchemeGroupVersion.WithKind("ValidatingWebhookConfiguration"), meta.RESTScopeRoot)
+
+	newRotator := func() *CertRotator {
+		rotator := &CertRotator{
+			SecretKey:            key,
+			CAName:               "ca",
+			CAOrganization:       "org",
+			CertName:             defaultCertName,
+			KeyName:              defaultKeyName,
+			CaCertDuration:       defaultCaCertValidityDuration,
+			ServerCertDuration:   defaultServerCertValidityDuration,
+			ExtKeyUsages:         &[]x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+			ClusterDomain:        defaultClusterDomain,
+			Webhooks:             []WebhookInfo{{Name: "vwh", Type: Validating}},
+			ServicesFromWebhooks: true,
+			CANameConstraints:    nameConstraints,
+			reader:               syncedReader{c},
+			apiReader:            c,
+			writer:               c,
+			webhookServices:      newWebhookServices(),
+		}
+		reconciler := &ReconcileWH{
+			reader:          rotator.reader,
+			mapper:          mapper,
+			webhooks:        rotator.Webhooks,
+			webhookServices: rotator.webhookServices,
+			secretKey:       key,
+			ctx:             ctx,
+		}
+		rotator.discoverWebhookServices = reconciler.updateWebhookServices
+		return rotator
+	}
+	getSecret := func() *corev1.Secret {
+		secret := &corev1.Secret{}
+		if err := c.Get(ctx, key, secret); err != nil {
+			t.Fatal(err)
+		}
+		return secret
+	}
+
+	if err := newRotator().refreshCertOnStart(); err != nil {
+		t.Fatal(err)
+	}
+	secret := getSecret()
+	crt, err := parseCertPEM(secret.Data[defaultCertName])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sets.New(crt.DNSNames...).Has("webhook.ns.svc") {
+		t.Fatalf("expected the server cert to be issued for the Service of the webhook, got %v", crt.DNSNames)
+	}
+
+	// Before the Services are discovered, the server cert is not considered to differ from its spec.
+	restarted := newRotator()
+	if !restarted.validServerCert(secret.Data[caCertName], secret.Data[defaultCertName], secret.Data[defaultKeyName]) {
+		t.Error("expected the server cert to be valid before the Services are discovered")
+	}
+	if !restarted.validCACert(secret.Data[caCertName], secret.Data[caKeyName]) {
+		t.Error("expected the CA cert to be valid before the Services are discovered")
+	}
+
+	if err := restarted.refreshCertOnStart(); err != nil {
+		t.Fatal(err)
+	}
+	if refreshed := getSecret(); refreshed.ResourceVersion != secret.ResourceVersion {
+		t.Error("expected the restarted rotator not to update the secret")
+	}
+}
@@ -0,0 +1,291 @@
+package rotator
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+const (
+	// rsaKeySize is the size of the generated RSA keys.
+	rsaKeySize = 2048
+	// certBackdate is how long before their creation certs are valid, to tolerate clock skew.
+	certBackdate = 1 * time.Hour
+)
+
+// certSpec is the desired spec of the server cert. When the server cert in the secret
+// differs from it, e.g. because the configuration of the CertRotator changed, it is re-issued.
+type certSpec struct {
+	subject        pkix.Name
+	dnsNames       []string
+	ipAddresses    []net.IP
+	uris           []*url.URL
+	emailAddresses []string
+	keyUsage       x509.KeyUsage
+	extKeyUsages   []x509.ExtKeyUsage
+	keyAlgorithm   x509.PublicKeyAlgorithm
+	keySize        int
+	// validity is the validity of the cert, or zero if it is not compared.
+	validity time.Duration
+	// partialDNSNames is true if dnsNames may lack names of the cert, e.g. the DNS names of
+	// Services not discovered yet, in which case the cert may hold more DNS names.
+	partialDNSNames bool
+	// commonNameFromDNSNames is true if the common name of the subject is the first DNS name.
+	commonNameFromDNSNames bool
+}
+
+// serverCertSpec returns the desired spec of the server cert.
+func (cr *CertRotator) serverCertSpec() certSpec {
+	spec := certSpec{
+		dnsNames:        cr.dnsNames(),
+		ipAddresses:     cr.IPAddresses,
+		uris:            cr.URIs,
+		emailAddresses:  cr.EmailAddresses,
+		keyUsage:        x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		keyAlgorithm:    x509.RSA,
+		keySize:         rsaKeySize,
+		partialDNSNames: cr.partialDNSNames(),
+	}
+	if cr.ServerSubject != nil {
+		spec.subject = *cr.ServerSubject
+	}
+	if spec.subject.CommonName == "" {
+		spec.subject.CommonName = cr.DNSName
+	}
+	if spec.subject.CommonName == "" {
+		spec.commonNameFromDNSNames = true
+		if len(spec.dnsNames) > 0 {
+			spec.subject.CommonName = spec.dnsNames[0]
+		}
+	}
+	if cr.ExtKeyUsages != nil {
+		spec.extKeyUsages = *cr.ExtKeyUsages
+	}
+	if cr.ServerCertDuration != 0 {
+		spec.validity = cr.ServerCertDuration + certBackdate
+	}
+	return spec
+}
+
+// template returns the template of a cert of the spec, valid from begin to end, without its
+// serial number.
+func (s certSpec) template(begin, end time.Time) *x509.Certificate {
+	return &x509.Certificate{
+		Subject:               s.subject,
+		DNSNames:              s.dnsNames,
+		IPAddresses:           s.ipAddresses,
+		URIs:                  s.uris,
+		EmailAddresses:        s.emailAddresses,
+		NotBefore:             begin,
+		NotAfter:              end,
+		KeyUsage:              s.keyUsage,
+		ExtKeyUsage:           s.extKeyUsages,
+		BasicConstraintsValid: true,
+	}
+}
+
+// changed returns the first attribute of the cert that differs from the spec,
+// or an empty string if the cert matches the spec.
+func (s certSpec) changed(crt *x509.Certificate) string {
+	ipStrings := func(ips []net.IP) sets.Set[string] {
+		set := sets.New[string]()
+		for _, ip := range ips {
+			set.Insert(ip.String())
+		}
+		return set
+	}
+	uriStrings := func(uris []*url.URL) sets.Set[string] {
+		set := sets.New[string]()
+		for _, uri := range uris {
+			set.Insert(uri.String())
+		}
+		return set
+	}
+	subject := s.subject
+	if s.partialDNSNames && s.commonNameFromDNSNames && slices.Contains(crt.DNSNames, crt.Subject.CommonName) {
+		// The first DNS name of the cert may be the one of a Service not discovered yet.
+		subject.CommonName = crt.Subject.CommonName
+	}
+	switch {
+	case crt.Subject.String() != subject.String():
+		return "subject"
+	case s.partialDNSNames && !sets.New(crt.DNSNames...).IsSuperset(sets.New(s.dnsNames...)):
+		return "dnsNames"
+	case !s.partialDNSNames && !sets.New(crt.DNSNames...).Equal(sets.New(s.dnsNames...)):
+		return "dnsNames"
+	case !ipStrings(crt.IPAddresses).Equal(ipStrings(s.ipAddresses)):
+		return "ipAddresses"
+	case !uriStrings(crt.URIs).Equal(uriStrings(s.uris)):
+		return "uris"
+	case !sets.New(crt.EmailAddresses...).Equal(sets.New(s.emailAddresses...)):
+		return "emailAddresses"
+	case crt.KeyUsage != s.keyUsage:
+		return "keyUsage"
+	case !sets.New(crt.ExtKeyUsage...).Equal(sets.New(s.extKeyUsages...)):
+		return "extKeyUsages"
+	case crt.PublicKeyAlgorithm != s.keyAlgorithm:
+		return "keyAlgorithm"
+	case keySize(crt) != s.keySize:
+		return "keySize"
+	case s.validity != 0 && crt.NotAfter.Sub(crt.NotBefore) != s.validity:
+		return "validity"
+	}
+	return ""
+}
+
+// caSpec is the desired spec of the CA cert. When the CA cert in the secret differs
+// from it, the CA is rotated.
+type caSpec struct {
+	subject pkix.Name
+	// dnsNames are the DNS names of the CA cert, which are omitted when it has name constraints,
+	// as a self-signed CA must satisfy its own constraints to be verified.
+	dnsNames            []string
+	nameConstraints     bool
+	permittedDNSDomains []string
+	// partialDNSDomains is true if permittedDNSDomains may lack the DNS names of Services not
+	// discovered yet, in which case the CA cert may permit more DNS domains.
+	partialDNSDomains       bool
+	permittedIPRanges       []*net.IPNet
+	excludedIPRanges        []*net.IPNet
+	permittedURIDomains     []string
+	permittedEmailAddresses []string
+}
+
+// caCertSpec returns the desired spec of the CA cert.
+func (cr *CertRotator) caCertSpec() caSpec {
+	var spec caSpec
+	if cr.CASubject != nil {
+		spec.subject = *cr.CASubject
+	}
+	if spec.subject.CommonName == "" {
+		spec.subject.CommonName = cr.CAName
+	}
+	if len(spec.subject.Organization) == 0 {
+		spec.subject.Organization = []string{cr.CAOrganization}
+	}
+	if !cr.CANameConstraints {
+		spec.dnsNames = []string{cr.CAName}
+		return spec
+	}
+
+	// The CA may only issue certs for the subject alternative names of the server certs.
+	spec.nameConstraints = true
+	spec.partialDNSDomains = cr.partialDNSNames()
+	servers := []certSpec{cr.serverCertSpec()}
+	for _, serverCert := range cr.ServerCerts {
+		servers = append(servers, cr.serverLeafCert(serverCert).spec)
+	}
+	for _, server := range servers {
+		spec.permittedDNSDomains = append(spec.permittedDNSDomains, server.dnsNames...)
+		for _, ip := range server.ipAddresses {
+			spec.permittedIPRanges = append(spec.permittedIPRanges, hostIPRange(ip))
+		}
+		for _, uri := range server.uris {
+			spec.permittedURIDomains = append(spec.permittedURIDomains, uri.Hostname())
+		}
+		spec.permittedEmailAddresses = append(spec.permittedEmailAddresses, server.emailAddresses...)
+	}
+	spec.permittedDNSDomains = append(spec.permittedDNSDomains, cr.PermittedDNSDomains...)
+	if len(spec.permittedIPRanges) == 0 {
+		spec.excludedIPRanges = []*net.IPNet{
+			{IP: net.IPv4zero, Mask: net.CIDRMask(0, 32)},
+			{IP: net.IPv6zero, Mask: net.CIDRMask(0, 128)},
+		}
+	}
+	return spec
+}
+
+// template sets the subject and name constraints of the spec in the template of the CA cert.
+func (s caSpec) template(templ *x509.Certificate) {
+	templ.Subject = s.subject
+	templ.DNSNames = s.dnsNames
+	if !s.nameConstraints {
+		return
+	}
+	templ.PermittedDNSDomainsCritical = true
+	templ.PermittedDNSDomains = s.permittedDNSDomains
+	templ.PermittedIPRanges = s.permittedIPRanges
+	templ.ExcludedIPRanges = s.excludedIPRanges
+	templ.PermittedURIDomains = s.permittedURIDomains
+	templ.PermittedEmailAddresses = s.permittedEmailAddresses
+}
+
+// changed returns the first attribute of the CA cert that differs from the spec,
+// or an empty string if the CA cert matches the spec.
+func (s caSpec) changed(crt *x509.Certificate) string {
+	ipRanges := func(ranges []*net.IPNet) sets.Set[string] {
+		set := sets.New[string]()
+		for _, r := range ranges {
+			set.Insert(r.String())
+		}
+		return set
+	}
+	switch {
+	case crt.Subject.String() != s.subject.String():
+		return "subject"
+	case !sets.New(crt.DNSNames...).Equal(sets.New(s.dnsNames...)):
+		return "dnsNames"
+	case s.partialDNSDomains && !sets.New(crt.PermittedDNSDomains...).IsSuperset(sets.New(s.permittedDNSDomains...)):
+		return "permittedDNSDomains"
+	case !s.partialDNSDomains && !sets.New(crt.PermittedDNSDomains...).Equal(sets.New(s.permittedDNSDomains...)):
+		return "permittedDNSDomains"
+	case !ipRanges(crt.PermittedIPRanges).Equal(ipRanges(s.permittedIPRanges)):
+		return "permittedIPRanges"
+	case !ipRanges(crt.ExcludedIPRanges).Equal(ipRanges(s.excludedIPRanges)):
+		return "excludedIPRanges"
+	case !sets.New(crt.PermittedURIDomains...).Equal(sets.New(s.permittedURIDomains...)):
+		return "permittedURIDomains"
+	case !sets.New(crt.PermittedEmailAddresses...).Equal(sets.New(s.permittedEmailAddresses...)):
+		return "permittedEmailAddresses"
+	}
+	return ""
+}
+
+// newSerialNumber returns a random 128-bit serial number, so that the CA certs and the certs
+// issued by a CA have unique serial numbers, as required by RFC 5280.
+func newSerialNumber() (*big.Int, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, errors.Wrap(err, "generating serial number")
+	}
+	return serial, nil
+}
+
+// hostIPRange returns the range of a single IP address.
+func hostIPRange(ip net.IP) *net.IPNet {
+	if ip4 := ip.To4(); ip4 != nil {
+		return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}
+}
+
+// keySize returns the size of the RSA public key of the cert, or zero for other keys.
+func keySize(crt *x509.Certificate) int {
+	if key, ok := crt.PublicKey.(*rsa.PublicKey); ok {
+		return key.N.BitLen()
+	}
+	return 0
+}
+
+// parseCertPEM parses a PEM encoded cert.
+func parseCertPEM(cert []byte) (*x509.Certificate, error) {
+	b, _ := pem.Decode(cert)
+	if b == nil {
+		return nil, errors.New("bad cert")
+	}
+	crt, err := x509.ParseCertificate(b.Bytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing cert")
+	}
+	return crt, nil
+}
@@ -0,0 +1,148 @@
+package rotator
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestServerCertSpecChanged(t *testing.T) {
+	newRotator := func() *CertRotator {
+		return &CertRotator{
+			CAName:             "ca",
+			CAOrganization:     "org",
+			DNSName:            "service.namespace",
+			ExtraDNSNames:      []string{"other-service.namespace"},
+			ExtKeyUsages:       &[]x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+			ServerCertDuration: defaultServerCertValidityDuration,
+		}
+	}
+	rotator := newRotator()
+	now := time.Now()
+	caArtifacts, err := rotator.CreateCACert(now.Add(-certBackdate), now.Add(defaultCaCertValidityDuration))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _, err := rotator.CreateCertPEM(caArtifacts, now.Add(-certBackdate), now.Add(rotator.ServerCertDuration))
+	if err != nil {
+		t.Fatal(err)
+	}
+	crt, err := parseCertPEM(cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed := rotator.serverCertSpec().changed(crt); changed != "" {
+		t.Fatalf("expected the cert to match its spec, got changed %s", changed)
+	}
+
+	// Every cert issued by the CA has its own serial number.
+	other, _, err := rotator.CreateCertPEM(caArtifacts, now.Add(-certBackdate), now.Add(rotator.ServerCertDuration))
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherCrt, err := parseCertPEM(other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if otherCrt.SerialNumber.Cmp(crt.SerialNumber) == 0 || crt.SerialNumber.Sign() <= 0 {
+		t.Errorf("expected unique positive serial numbers, got %s and %s", crt.SerialNumber, otherCrt.SerialNumber)
+	}
+
+	testCases := []struct {
+		name   string
+		change func(*CertRotator)
+		want   string
+	}{
+		{"added DNS name", func(r *CertRotator) { r.ExtraDNSNames = append(r.ExtraDNSNames, "new.namespace") }, "dnsNames"},
+		{"removed DNS name", func(r *CertRotator) { r.ExtraDNSNames = nil }, "dnsNames"},
+		{"subject", func(r *CertRotator) { r.DNSName = "other-service.namespace" }, "subject"},
+		{"key usages", func(r *CertRotator) {
+			r.ExtKeyUsages = &[]x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}
+		}, "extKeyUsages"},
+		{"validity", func(r *CertRotator) { r.ServerCertDuration = time.Hour }, "validity"},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newRotator()
+			tt.change(r)
+			if got := r.serverCertSpec().changed(crt); got != tt.want {
+				t.Errorf("got changed %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCANameConstraints(t *testing.T) {
+	spiffe, _ := url.Parse("spiffe://cluster.local/ns/ns/sa/webhook")
+	rotator := &CertRotator{
+		CASubject:           &pkix.Name{CommonName: "webhook-ca", Organization: []string{"org"}, Country: []string{"NL"}},
+		ServerSubject:       &pkix.Name{Organization: []string{"org"}},
+		Services:            []types.NamespacedName{{Namespace: "ns", Name: "webhook"}},
+		IPAddresses:         []net.IP{net.ParseIP("10.0.0.1")},
+		URIs:                []*url.URL{spiffe},
+		CANameConstraints:   true,
+		PermittedDNSDomains: []string{"example.com"},
+		ExtKeyUsages:        &[]x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	caArtifacts, err := rotator.CreateCACert(begin, end)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !rotator.validCACert(caArtifacts.CertPEM, caArtifacts.KeyPEM) {
+		t.Fatal("expected the CA cert to be valid")
+	}
+	if got := caArtifacts.Cert.Subject.String(); got != "CN=webhook-ca,O=org,C=NL" {
+		t.Errorf("got CA subject %s", got)
+	}
+	cert, key, err := rotator.CreateCertPEM(caArtifacts, begin, end)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !rotator.validServerCert(caArtifacts.CertPEM, cert, key) {
+		t.Fatal("expected the server cert to be valid")
+	}
+	crt, err := parseCertPEM(cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := crt.Subject.String(); got != "CN=webhook,O=org" {
+		t.Errorf("got server subject %s", got)
+	}
+
+	// The CA cannot issue certs for other hosts.
+	for name, other := range map[string]*CertRotator{
+		"DNS name":   {DNSName: "other.example.org", ExtKeyUsages: rotator.ExtKeyUsages},
+		"IP address": {DNSName: "webhook", IPAddresses: []net.IP{net.ParseIP("10.0.0.2")}, ExtKeyUsages: rotator.ExtKeyUsages},
+	} {
+		otherCert, otherKey, err := other.CreateCertPEM(caArtifacts, begin, end)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if other.validServerCert(caArtifacts.CertPEM, otherCert, otherKey) {
+			t.Errorf("expected a cert for another %s not to be valid", name)
+		}
+	}
+	subdomain := &CertRotator{DNSName: "webhook.example.com", ExtKeyUsages: rotator.ExtKeyUsages}
+	subdomainCert, subdomainKey, err := subdomain.CreateCertPEM(caArtifacts, begin, end)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !subdomain.validServerCert(caArtifacts.CertPEM, subdomainCert, subdomainKey) {
+		t.Error("expected a cert for a subdomain of a permitted DNS domain to be valid")
+	}
+
+	// The CA is rotated when the names of the server cert change.
+	rotator.Services = append(rotator.Services, types.NamespacedName{Namespace: "ns", Name: "other"})
+	if got := rotator.caCertSpec().changed(caArtifacts.Cert); got != "permittedDNSDomains" {
+		t.Errorf("got changed %q, want permittedDNSDomains", got)
+	}
+	rotator.CANameConstraints = false
+	if rotator.validCACert(caArtifacts.CertPEM, caArtifacts.KeyPEM) {
+		t.Error("expected the constrained CA cert not to be valid without name constraints")
+	}
+}
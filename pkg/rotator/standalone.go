@@ -0,0 +1,91 @@
+package rotator
+
+import (
+	"context"
+	"fmt"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	apiregistrationv1 "k8s.io/kube-aggregator/pkg/apis/apiregistration/v1"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/metrics/server"
+)
+
+// Options configure a standalone Rotator.
+type Options struct {
+	// LeaderElectionID is the name of the lease used for leader election when
+	// CertRotator.RequireLeaderElection is set. Defaults to "<secret name>-cert-rotator".
+	LeaderElectionID string
+	// LeaderElectionNamespace is the namespace of the lease. Defaults to the namespace of the secret.
+	LeaderElectionNamespace string
+}
+
+// Rotator runs a CertRotator on its own, for components that do not use a controller-runtime
+// manager, such as plain net/http servers. It owns the informers, the leader election and the
+// reconcile loop of the CertRotator, which behaves as if it was added to a manager by AddRotator.
+type Rotator struct {
+	mgr manager.Manager
+}
+
+// New returns a Rotator running the CertRotator against the cluster of the config.
+// The CertRotator only rotates certificates while it is the elected leader if its
+// RequireLeaderElection is set. The kinds of Generic webhooks are accessed as unstructured
+// objects, so that only the kinds of the built-in webhook types are registered.
+func New(config *rest.Config, cr *CertRotator, opts Options) (*Rotator, error) {
+	if config == nil || cr == nil {
+		return nil, fmt.Errorf("nil arguments")
+	}
+	scheme, err := standaloneScheme()
+	if err != nil {
+		return nil, fmt.Errorf("building scheme: %w", err)
+	}
+
+	mgrOpts := manager.Options{
+		Scheme: scheme,
+		// The rotator does not serve metrics nor health probes of its own.
+		Metrics:                server.Options{BindAddress: "0"},
+		HealthProbeBindAddress: "0",
+		LeaderElection:         cr.RequireLeaderElection,
+	}
+	if cr.RequireLeaderElection {
+		mgrOpts.LeaderElectionID = opts.LeaderElectionID
+		if mgrOpts.LeaderElectionID == "" {
+			mgrOpts.LeaderElectionID = cr.SecretKey.Name + "-cert-rotator"
+		}
+		mgrOpts.LeaderElectionNamespace = opts.LeaderElectionNamespace
+		if mgrOpts.LeaderElectionNamespace == "" {
+			mgrOpts.LeaderElectionNamespace = cr.SecretKey.Namespace
+		}
+	}
+	mgr, err := manager.New(config, mgrOpts)
+	if err != nil {
+		return nil, fmt.Errorf("creating manager: %w", err)
+	}
+	if err := AddRotator(mgr, cr); err != nil {
+		return nil, err
+	}
+	return &Rotator{mgr: mgr}, nil
+}
+
+// standaloneScheme returns the scheme of the kinds of the built-in webhook types: the
+// Kubernetes API, CustomResourceDefinitions and APIServices.
+func standaloneScheme() (*runtime.Scheme, error) {
+	scheme := runtime.NewScheme()
+	for _, addToScheme := range []func(*runtime.Scheme) error{
+		clientgoscheme.AddToScheme,
+		apiextensionsv1.AddToScheme,
+		apiregistrationv1.AddToScheme,
+	} {
+		if err := addToScheme(scheme); err != nil {
+			return nil, err
+		}
+	}
+	return scheme, nil
+}
+
+// Run runs the Rotator until the context is done.
+func (r *Rotator) Run(ctx context.Context) error {
+	return r.mgr.Start(ctx)
+}
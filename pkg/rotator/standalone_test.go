@@ -0,0 +1,109 @@
+package rotator
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	apiregistrationv1 "k8s.io/kube-aggregator/pkg/apis/apiregistration/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestStandaloneRotator(t *testing.T) {
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	defer cancelFunc()
+	g := gomega.NewWithT(t)
+
+	c, err := client.New(cfg, client.Options{})
+	g.Expect(err).NotTo(gomega.HaveOccurred(), "creating client")
+
+	key := types.NamespacedName{Namespace: "test-standalone", Name: "test-secret"}
+	rotator := &CertRotator{
+		SecretKey: key,
+		Webhooks: []WebhookInfo{
+			{Name: "test-ca", Type: ConfigMap},
+		},
+		RequireLeaderElection: true,
+		ControllerName:        t.Name(),
+	}
+	r, err := New(cfg, rotator, Options{})
+	g.Expect(err).NotTo(gomega.HaveOccurred(), "creating rotator")
+
+	createSecret(ctx, g, c, key)
+	wh := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: key.Namespace, Name: "test-ca"},
+	}
+	err = c.Create(ctx, wh)
+	g.Expect(err).NotTo(gomega.HaveOccurred(), "creating configmap")
+
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		g.Expect(r.Run(ctx)).NotTo(gomega.HaveOccurred())
+	}()
+
+	ensureCertWasGenerated(ctx, g, c, key)
+	ensureWebhookPopulated(ctx, g, c, wh, nil, []string{"data", "ca.crt"}, "")
+
+	cancelFunc()
+	wg.Wait()
+}
+
+// Verifies that a standalone rotator injects the CA cert into webhook kinds outside of the
+// Kubernetes API, such as APIServices.
+func TestStandaloneAPIService(t *testing.T) {
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	defer cancelFunc()
+	g := gomega.NewWithT(t)
+
+	scheme, err := standaloneScheme()
+	g.Expect(err).NotTo(gomega.HaveOccurred(), "building scheme")
+	c, err := client.New(cfg, client.Options{Scheme: scheme})
+	g.Expect(err).NotTo(gomega.HaveOccurred(), "creating client")
+
+	key := types.NamespacedName{Namespace: "test-standalone-apiservice", Name: "test-secret"}
+	rotator := &CertRotator{
+		SecretKey: key,
+		Webhooks: []WebhookInfo{
+			{Name: "v1alpha1.standalone.example.com", Type: APIService},
+		},
+		ControllerName: t.Name(),
+	}
+	r, err := New(cfg, rotator, Options{})
+	g.Expect(err).NotTo(gomega.HaveOccurred(), "creating rotator")
+
+	createSecret(ctx, g, c, key)
+	apiService := &apiregistrationv1.APIService{
+		ObjectMeta: metav1.ObjectMeta{Name: "v1alpha1.standalone.example.com"},
+		Spec: apiregistrationv1.APIServiceSpec{
+			Group:                "standalone.example.com",
+			GroupPriorityMinimum: 1,
+			Version:              "v1alpha1",
+			VersionPriority:      1,
+			Service: &apiregistrationv1.ServiceReference{
+				Namespace: "kube-system",
+				Name:      "standalone-api",
+			},
+		},
+	}
+	err = c.Create(ctx, apiService)
+	g.Expect(err).NotTo(gomega.HaveOccurred(), "creating APIService")
+
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		g.Expect(r.Run(ctx)).NotTo(gomega.HaveOccurred())
+	}()
+
+	ensureCertWasGenerated(ctx, g, c, key)
+	ensureWebhookPopulated(ctx, g, c, apiService, nil, []string{"spec", "caBundle"}, "")
+
+	cancelFunc()
+	wg.Wait()
+}
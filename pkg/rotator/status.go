@@ -0,0 +1,221 @@
+package rotator
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// InjectionState is the state of the CA bundle injection into a webhook.
+type InjectionState string
+
+const (
+	// InjectionPending indicates the webhook has not been reconciled yet.
+	InjectionPending InjectionState = "Pending"
+	// Injected indicates the CA bundle was injected into the webhook.
+	Injected InjectionState = "Injected"
+	// WebhookNotFound indicates the resource of the webhook does not exist.
+	WebhookNotFound InjectionState = "NotFound"
+	// WebhookDeleting indicates the resource of the webhook is being deleted.
+	WebhookDeleting InjectionState = "Deleting"
+	// KindNotServed indicates the kind of the webhook is not served by the API server,
+	// e.g. because its CRD is not installed.
+	KindNotServed InjectionState = "KindNotServed"
+	// InjectionFailed indicates the CA bundle could not be injected into the webhook.
+	InjectionFailed InjectionState = "Failed"
+)
+
+// WebhookStatus is the status of the CA bundle injection into a webhook.
+type WebhookStatus struct {
+	Webhook WebhookInfo
+	State   InjectionState
+	// Err is the error of the last reconcile, if any.
+	Err error
+	// Fingerprint is the SHA-256 fingerprint of the CA bundle last injected into the webhook.
+	Fingerprint string
+	// Current is true if the webhook carries the current CA cert of the secret.
+	Current bool
+	// Degraded is true if the webhook carried the current CA cert but no longer does,
+	// e.g. because its CA bundle was edited or the webhook was deleted. It stays true after
+	// the CA bundle is rewritten, until the webhook is next found to carry the current CA cert.
+	Degraded bool
+	// LastDriftTime is the last time the CA bundle of the webhook was found to differ
+	// from the injected one.
+	LastDriftTime time.Time
+	// DriftCorrections is the number of times the CA bundle of the webhook was found to
+	// differ from the injected one, and was rewritten or attempted to be.
+	DriftCorrections int
+	// LastReconcileTime is the time the webhook was last reconciled.
+	LastReconcileTime time.Time
+}
+
+// WebhookError is an error reconciling the CA bundle of a single webhook.
+type WebhookError struct {
+	Webhook WebhookInfo
+	State   InjectionState
+	Err     error
+}
+
+func (e *WebhookError) Error() string {
+	return fmt.Sprintf("webhook %s: %s: %v", e.Webhook.Name, e.State, e.Err)
+}
+
+func (e *WebhookError) Unwrap() error {
+	return e.Err
+}
+
+// WebhookErrors are the errors of all webhooks that could not be injected during a reconcile.
+type WebhookErrors []*WebhookError
+
+func (e WebhookErrors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func (e WebhookErrors) Unwrap() []error {
+	errs := make([]error, 0, len(e))
+	for _, err := range e {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// hasState returns true if any of the errors is in the given state.
+func (e WebhookErrors) hasState(state InjectionState) bool {
+	for _, err := range e {
+		if err.State == state {
+			return true
+		}
+	}
+	return false
+}
+
+// caFingerprint returns the SHA-256 fingerprint of a PEM encoded CA bundle.
+func caFingerprint(certPem []byte) string {
+	sum := sha256.Sum256(certPem)
+	return hex.EncodeToString(sum[:])
+}
+
+// webhookStatuses holds the status of every webhook, in the order they were configured.
+type webhookStatuses struct {
+	mu       sync.RWMutex
+	statuses []WebhookStatus
+	// reconciled is true once the webhooks have been reconciled without failures.
+	reconciled bool
+	// fingerprint is the fingerprint of the current CA cert of the secret.
+	fingerprint string
+}
+
+func newWebhookStatuses(webhooks []WebhookInfo) *webhookStatuses {
+	s := &webhookStatuses{statuses: make([]WebhookStatus, 0, len(webhooks))}
+	for _, webhook := range webhooks {
+		s.statuses = append(s.statuses, WebhookStatus{Webhook: webhook, State: InjectionPending})
+	}
+	return s
+}
+
+// setCA sets the PEM encoded CA cert that the webhooks are expected to carry.
+func (s *webhookStatuses) setCA(certPem []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fingerprint = caFingerprint(certPem)
+	for i := range s.statuses {
+		s.statuses[i].Current = s.statuses[i].State == Injected && s.statuses[i].Fingerprint == s.fingerprint
+	}
+}
+
+// set records the outcome of reconciling the webhook at index i. Injected webhooks
+// carry the current CA cert.
+func (s *webhookStatuses) set(i int, state InjectionState, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	status := &s.statuses[i]
+	if state == Injected {
+		status.Fingerprint = s.fingerprint
+	} else if status.Current {
+		status.Degraded = true
+	}
+	status.State = state
+	status.Err = err
+	status.Current = state == Injected
+	status.LastReconcileTime = time.Now()
+}
+
+// injected returns true if the current CA cert was injected into the webhook at index i.
+func (s *webhookStatuses) injected(i int) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.statuses[i].Current
+}
+
+// drifted records that the CA bundle of the webhook at index i differs from the injected one,
+// before it is rewritten.
+func (s *webhookStatuses) drifted(i int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.statuses[i].Degraded = true
+	s.statuses[i].LastDriftTime = time.Now()
+	s.statuses[i].DriftCorrections++
+}
+
+// verified records that the webhook at index i was found to carry the current CA cert.
+func (s *webhookStatuses) verified(i int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.statuses[i].Degraded = false
+}
+
+func (s *webhookStatuses) setReconciled() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reconciled = true
+}
+
+func (s *webhookStatuses) list() []WebhookStatus {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]WebhookStatus(nil), s.statuses...)
+}
+
+// notCurrent returns the required webhooks that do not carry the current CA cert.
+func (s *webhookStatuses) notCurrent() []WebhookStatus {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var statuses []WebhookStatus
+	for _, status := range s.statuses {
+		if !status.Webhook.Optional && !status.Current {
+			statuses = append(statuses, status)
+		}
+	}
+	return statuses
+}
+
+// ready returns true once the webhooks have been reconciled. If requireAll is true,
+// every required webhook must also carry the current CA cert.
+func (s *webhookStatuses) ready(requireAll bool) bool {
+	s.mu.RLock()
+	reconciled := s.reconciled
+	s.mu.RUnlock()
+	if !reconciled {
+		return false
+	}
+	return !requireAll || len(s.notCurrent()) == 0
+}
+
+// waitingForKinds returns true if the only required webhooks that do not carry the current
+// CA cert are those whose kind is not served yet, and which are injected once it is.
+func (s *webhookStatuses) waitingForKinds() bool {
+	notCurrent := s.notCurrent()
+	for _, status := range notCurrent {
+		if status.State != KindNotServed {
+			return false
+		}
+	}
+	return len(notCurrent) > 0
+}
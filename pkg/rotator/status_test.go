@@ -0,0 +1,113 @@
+package rotator
+
+import (
+	"errors"
+	"testing"
+
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestWebhookErrors(t *testing.T) {
+	notFound := k8sErrors.NewNotFound(schema.GroupResource{Resource: "validatingwebhookconfigurations"}, "first")
+	failed := errors.New("conflict")
+	errs := WebhookErrors{
+		{Webhook: WebhookInfo{Name: "first"}, State: WebhookNotFound, Err: notFound},
+		{Webhook: WebhookInfo{Name: "second"}, State: InjectionFailed, Err: failed},
+	}
+
+	var err error = errs
+	if !errors.Is(err, failed) {
+		t.Error("expected the error of the second webhook to be found")
+	}
+	if !k8sErrors.IsNotFound(errs[0]) {
+		t.Error("expected the error of the first webhook to be NotFound")
+	}
+	var webhookErr *WebhookError
+	if !errors.As(err, &webhookErr) || webhookErr.Webhook.Name != "first" {
+		t.Errorf("expected the first webhook error, got %v", webhookErr)
+	}
+	if !errs.hasState(InjectionFailed) || errs.hasState(KindNotServed) {
+		t.Error("unexpected states")
+	}
+	want := `webhook first: NotFound: validatingwebhookconfigurations "first" not found; webhook second: Failed: conflict`
+	if err.Error() != want {
+		t.Errorf("got %q, want %q", err.Error(), want)
+	}
+}
+
+func TestWebhookStatuses(t *testing.T) {
+	s := newWebhookStatuses([]WebhookInfo{{Name: "first"}, {Name: "second"}, {Name: "optional", Optional: true}})
+	for _, status := range s.list() {
+		if status.State != InjectionPending {
+			t.Errorf("webhook %s: got state %s, want %s", status.Webhook.Name, status.State, InjectionPending)
+		}
+	}
+	if s.ready(false) {
+		t.Error("expected not to be ready before reconciling")
+	}
+
+	ca1 := []byte("ca1")
+	s.setCA(ca1)
+	s.set(0, Injected, nil)
+	s.set(1, WebhookNotFound, errors.New("not found"))
+	s.set(2, WebhookNotFound, errors.New("not found"))
+	s.setReconciled()
+	if !s.ready(false) {
+		t.Error("expected to be ready once reconciled")
+	}
+	if s.ready(true) {
+		t.Error("expected not to be ready while a required webhook is not injected")
+	}
+
+	s.set(1, Injected, nil)
+	if !s.ready(true) {
+		t.Error("expected to be ready once all required webhooks are injected")
+	}
+	if got := s.list()[0].Fingerprint; got != caFingerprint(ca1) {
+		t.Errorf("got fingerprint %s, want %s", got, caFingerprint(ca1))
+	}
+
+	// A rotated CA is not carried by the webhooks until they are injected again.
+	s.setCA([]byte("ca2"))
+	if s.ready(true) || s.injected(0) {
+		t.Error("expected webhooks not to carry the rotated CA")
+	}
+	s.set(0, Injected, nil)
+	s.set(1, KindNotServed, errors.New("no matches for kind"))
+	if s.ready(true) || !s.waitingForKinds() {
+		t.Error("expected to wait for the kind of the second webhook to be served")
+	}
+	s.set(1, Injected, nil)
+	if !s.ready(true) || s.waitingForKinds() {
+		t.Error("expected webhooks to carry the rotated CA")
+	}
+
+	// Drift that cannot be corrected leaves the webhook degraded.
+	s.drifted(0)
+	s.set(0, InjectionFailed, errors.New("conflict"))
+	status := s.list()[0]
+	if !status.Degraded || status.Current || status.LastDriftTime.IsZero() {
+		t.Errorf("expected webhook to be degraded, got %+v", status)
+	}
+	if status.DriftCorrections != 1 {
+		t.Errorf("expected drift to be recorded before it is corrected, got %+v", status)
+	}
+
+	// A corrected webhook stays degraded until it is verified to carry the current CA cert.
+	s.set(0, Injected, nil)
+	if status := s.list()[0]; !status.Degraded || !status.Current {
+		t.Errorf("expected corrected webhook to stay degraded, got %+v", status)
+	}
+	s.verified(0)
+	s.set(0, Injected, nil)
+	if status := s.list()[0]; status.Degraded || !status.Current || status.DriftCorrections != 1 {
+		t.Errorf("expected webhook to be verified, got %+v", status)
+	}
+
+	statuses := s.list()
+	statuses[0].State = InjectionFailed
+	if s.list()[0].State != Injected {
+		t.Error("expected list to return a copy")
+	}
+}